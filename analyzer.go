@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -15,6 +18,12 @@ type Analyzer struct {
 	config *Config
 	matcher *PatternMatcher
 	tokenizer Tokenizer
+	git *GitRepo
+	transforms []ContentTransform
+	sensitiveSkipped []string
+	// selection restricts listings to a saved selection set, when one is
+	// being packed
+	selection map[string]bool
 }
 
 
@@ -24,88 +33,105 @@ func NewAnalyzer(cfg *Config) (*Analyzer, error) {
 		return nil, fmt.Errorf("failed to create tokenizer: %w", err)
 	}
 
+	transforms, err := NewTransformPipeline(cfg.Transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	var git *GitRepo
+	if cfg.GitTracked || cfg.ChangedSince != "" || cfg.Staged || cfg.Unstaged {
+		git, err = OpenGitRepo(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Analyzer{
-		config:    cfg,
-		matcher:   NewPatternMatcher(cfg.Include, cfg.Exclude),
-		tokenizer: tokenizer,
+		config:     cfg,
+		matcher:    NewPatternMatcher(cfg.Include, cfg.Exclude),
+		tokenizer:  tokenizer,
+		git:        git,
+		transforms: transforms,
 	}, nil
 }
 
 func (a *Analyzer) ProcessDirectory() error {
-	var entries []FileEntry
-	var wg sync.WaitGroup
-	entriesChan := make(chan FileEntry)
-	errorsChan := make(chan error)
-	done := make(chan bool)
-
-	go func() {
-		for entry := range entriesChan {
-			entries = append(entries, entry)
-		}
-		done <- true
-	}()
+	entries, err := a.CollectFiles()
+	if err != nil {
+		return err
+	}
 
-	err := filepath.Walk(a.config.Path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if relPath, err := filepath.Rel(a.config.Path, path); err == nil {
-			if strings.Count(relPath, string(os.PathSeparator)) > a.config.MaxDepth {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-		}
+	header, err := a.Header()
+	if err != nil {
+		return err
+	}
 
-		if info.IsDir() {
-			return nil
-		}
+	return generateOutput(entries, header, a.config)
+}
 
-		if !a.shouldProcessFile(path, info) {
-			return nil
-		}
+func (a *Analyzer) shouldProcessFile(path string, size int64) bool {
+	if !a.config.Hidden && strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
 
-		wg.Add(1)
-		go func(p string) {
-			defer wg.Done()
-			if entry, err := a.processFile(p); err != nil {
-				errorsChan <- err
-			} else {
-				entriesChan <- entry
-			}
-		}(path)
+	// peeker's own state, such as saved selections
+	if relPath, err := filepath.Rel(a.config.Path, path); err == nil &&
+		strings.HasPrefix(filepath.ToSlash(relPath), ".peeker/") {
+		return false
+	}
+
+	if size > a.config.MaxSize {
+		return false
+	}
 
-		return nil
-	})
+	// Files whose language needs a shebang to tell are checked once read
+	if lang := languageFromPath(path); lang != "" && !a.wantsLanguage(lang) {
+		return false
+	}
 
-	if err != nil {
-		return err
+	if !a.matcher.ShouldProcess(path) {
+		return false
 	}
 
-	go func() {
-		wg.Wait()
-		close(entriesChan)
-	}()
+	if !a.config.AllowSensitive && isSensitive(path) {
+		if relPath, err := filepath.Rel(a.config.Path, path); err == nil {
+			a.sensitiveSkipped = append(a.sensitiveSkipped, relPath)
+		}
+		return false
+	}
 
-	<-done
+	return true
+}
 
-	return generateOutput(entries, a.config.Output, a.config.UseClip)
+// SensitiveSkipped returns the files left out by the last ListFiles because
+// they may contain credentials.
+func (a *Analyzer) SensitiveSkipped() []string {
+	return a.sensitiveSkipped
 }
 
-func (a *Analyzer) shouldProcessFile(path string, info os.FileInfo) bool {
-	if !a.config.Hidden && strings.HasPrefix(filepath.Base(path), ".") {
-		return false
+func (a *Analyzer) wantsLanguage(lang string) bool {
+	if len(a.config.Languages) == 0 {
+		return true
 	}
 
-	if info.Size() > a.config.MaxSize {
-		return false
+	lang = normalizeLanguage(lang)
+	for _, want := range a.config.Languages {
+		if want == lang {
+			return true
+		}
 	}
-
-	return a.matcher.ShouldProcess(path)
+	return false
 }
 
 func (a *Analyzer) processFile(path string) (FileEntry, error) {
+    if !a.config.AllowSensitive && isSensitive(path) {
+        return FileEntry{}, &SkipError{Kind: "sensitive", Reason: "may contain credentials"}
+    }
+
+    if a.config.GitRef != "" {
+        return a.processGitFile(path)
+    }
+
     // First check if it's a text file by reading the first few bytes
     f, err := os.Open(path)
     if err != nil {
@@ -118,9 +144,10 @@ func (a *Analyzer) processFile(path string) (FileEntry, error) {
         return FileEntry{}, err
     }
 
-    // For large files, show a separate progress bar
+    // For large files, show a separate progress bar, unless the picker is
+    // loading them in the background
     var progress *ProgressTracker
-    if info.Size() > 1024*1024 { // 1MB
+    if info.Size() > 1024*1024 && !a.config.Interactive { // 1MB
         progress = NewProgressTracker(info.Size(), fmt.Sprintf("Reading %s", filepath.Base(path)))
     }
 
@@ -133,8 +160,8 @@ func (a *Analyzer) processFile(path string) (FileEntry, error) {
     buffer = buffer[:n]
 
     // Check if file appears to be binary
-    if isBinary(buffer) {
-        return FileEntry{}, nil
+    if binary, reason := detectBinary(buffer); binary {
+        return FileEntry{}, &SkipError{Kind: "binary", Reason: reason}
     }
 
     // If we get here, file is probably text, read the whole thing
@@ -162,26 +189,133 @@ func (a *Analyzer) processFile(path string) (FileEntry, error) {
             progress.Finish()
         }
         
-        return a.createFileEntry(path, content.String(), info)
+        return a.createFileEntry(path, content.Bytes(), info.Size())
     } else {
         // For smaller files, read all at once
         content, err := ioutil.ReadFile(path)
         if err != nil {
             return FileEntry{}, err
         }
-        return a.createFileEntry(path, string(content), info)
+        return a.createFileEntry(path, content, info.Size())
     }
 }
 
-func (a *Analyzer) createFileEntry(path string, content string, info os.FileInfo) (FileEntry, error) {
+func (a *Analyzer) processGitFile(path string) (FileEntry, error) {
     relPath, err := filepath.Rel(a.config.Path, path)
     if err != nil {
         return FileEntry{}, err
     }
 
+    content, err := a.git.Show(a.config.GitRef, relPath)
+    if err != nil {
+        return FileEntry{}, err
+    }
+
+    head := content
+    if len(head) > 512 {
+        head = head[:512]
+    }
+    if binary, reason := detectBinary(head); binary {
+        return FileEntry{}, &SkipError{Kind: "binary", Reason: reason}
+    }
+
+    return a.createFileEntry(path, content, int64(len(content)))
+}
+
+func (a *Analyzer) createFileEntry(path string, raw []byte, size int64) (FileEntry, error) {
+    relPath, err := filepath.Rel(a.config.Path, path)
+    if err != nil {
+        return FileEntry{}, err
+    }
+
+    content, encoding, err := decodeText(raw)
+    if err != nil {
+        return FileEntry{}, err
+    }
+    var warnings []string
+    if encoding == EncodingShiftJIS || encoding == EncodingWindows1252 {
+        warnings = append(warnings, fmt.Sprintf("not valid UTF-8, decoded as %s", encoding))
+    }
+
+    startLine := 1
+    for _, lineRange := range a.config.LineRanges {
+        if matchPattern(lineRange.Pattern, relPath) {
+            content = sliceLines(content, lineRange.Start, lineRange.End)
+            startLine = lineRange.Start
+            break
+        }
+    }
+
+    language := detectLanguage(relPath, content)
+    if !a.wantsLanguage(language) {
+        reason := language
+        if reason == "" {
+            reason = "unknown language"
+        }
+        return FileEntry{}, &SkipError{Kind: "other-language", Reason: reason}
+    }
+
+    var generated string
+    if a.config.Generated != "include" {
+        generated = detectGenerated(relPath, content)
+        if generated != "" && a.config.Generated == "exclude" {
+            return FileEntry{}, &SkipError{Kind: "generated", Reason: generated}
+        }
+    }
+
+    // Scan before the outline and transforms so findings keep their source
+    // line numbers
+    var secrets []SecretFinding
+    if a.config.Secrets != "off" {
+        content, secrets = scanSecrets(content)
+        for i := range secrets {
+            secrets[i].Line += startLine - 1
+        }
+    }
+
+    outlined := false
+    if outliner, ok := outliners[language]; ok && a.config.Outline && !a.wantsFullContent(relPath) {
+        outline, err := outliner.Outline(content)
+        if err != nil {
+            warnings = append(warnings, fmt.Sprintf("%v; using full content", err))
+        } else {
+            content = outline
+            outlined = true
+        }
+    }
+
+    var savings map[string]int
+    if len(a.transforms) > 0 {
+        savings, content, err = a.applyTransforms(content, language)
+        if err != nil {
+            return FileEntry{}, err
+        }
+    }
+
+    var diff string
+    if a.config.WithDiff || a.config.DiffOnly {
+        diff, err = a.git.Diff(relPath, append(a.diffOptions(), a.diffArgs()...)...)
+        if err != nil {
+            return FileEntry{}, fmt.Errorf("failed to diff: %w", err)
+        }
+        if a.config.DiffOnly {
+            content = ""
+            secrets = nil
+        }
+    }
+
+    if a.config.Secrets != "off" && diff != "" {
+        var found []SecretFinding
+        diff, found = scanSecrets(diff)
+        for _, secret := range found {
+            secret.InDiff = true
+            secrets = append(secrets, secret)
+        }
+    }
+
     var tokenCount *TokenCount
     if a.tokenizer != nil {
-        count, err := a.tokenizer.CountTokens(content)
+        count, err := a.tokenizer.CountTokens(content + diff)
         if err != nil {
             return FileEntry{}, fmt.Errorf("failed to count tokens: %w", err)
         }
@@ -191,99 +325,338 @@ func (a *Analyzer) createFileEntry(path string, content string, info os.FileInfo
     return FileEntry{
         Path:       relPath,
         Content:    content,
-        Size:       info.Size(),
+        Size:       size,
+        Encoding:   encoding,
+        Language:   language,
+        Generated:  generated,
+        Outlined:   outlined,
+        StartLine:  startLine,
+        Diff:       diff,
         TokenCount: tokenCount,
+        Savings:    savings,
+        Secrets:    secrets,
+        Warnings:   warnings,
     }, nil
 }
 
-func isBinary(buf []byte) bool {
-    const binary_threshold = 0.3
-    if len(buf) == 0 {
-        return false
+// printWarnings reports the problems met while reading entry, such as a
+// legacy encoding, for the modes that do not show them in the picker.
+func printWarnings(entry FileEntry) {
+    for _, warning := range entry.Warnings {
+        fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", entry.Path, warning)
     }
+}
 
-    binaryCount := 0
-    for _, b := range buf {
-        if b == 0 || (b < 7 && b != 5 && b != 4) || (b > 14 && b < 32 && b != '\n' && b != '\r' && b != '\t') {
-            binaryCount++
+// sliceLines returns lines start through end (1-based, inclusive) of content.
+func sliceLines(content string, start, end int) string {
+    lines := strings.SplitAfter(content, "\n")
+    if start > len(lines) {
+        return ""
+    }
+    if end > len(lines) {
+        end = len(lines)
+    }
+    return strings.Join(lines[start-1:end], "")
+}
+
+// wantsFullContent reports whether path was named by --full, exempting it
+// from --outline.
+func (a *Analyzer) wantsFullContent(path string) bool {
+    for _, pattern := range a.config.Full {
+        if matchPattern(pattern, path) {
+            return true
         }
     }
+    return false
+}
 
-    return float64(binaryCount)/float64(len(buf)) > binary_threshold
+// applyTransforms runs the transform pipeline over content, recording how many
+// tokens each transform saved.
+func (a *Analyzer) applyTransforms(content, language string) (map[string]int, string, error) {
+    savings := make(map[string]int, len(a.transforms))
+    before := -1
+    for _, t := range a.transforms {
+        transformed := t.Apply(content, language)
+        if a.tokenizer != nil && transformed != content {
+            if before < 0 {
+                count, err := a.tokenizer.CountTokens(content)
+                if err != nil {
+                    return nil, "", fmt.Errorf("failed to count tokens: %w", err)
+                }
+                before = count.Count
+            }
+            count, err := a.tokenizer.CountTokens(transformed)
+            if err != nil {
+                return nil, "", fmt.Errorf("failed to count tokens: %w", err)
+            }
+            savings[t.Name()] += before - count.Count
+            before = count.Count
+        }
+        content = transformed
+    }
+    return savings, content, nil
 }
 
-func (a *Analyzer) CollectFiles() ([]FileEntry, error) {
-    var entries []FileEntry
-    var wg sync.WaitGroup
-    entriesChan := make(chan FileEntry)
-    errorsChan := make(chan error)
-    done := make(chan bool)
+// ListFiles returns the files that would be analyzed, with only Path and Size
+// filled in.
+func (a *Analyzer) ListFiles() ([]FileEntry, error) {
+    var files []FileEntry
+    var err error
+    a.sensitiveSkipped = nil
+    if a.config.GitTracked {
+        files, err = a.listGitFiles()
+    } else {
+        files, err = a.walkFiles()
+    }
+    if err != nil {
+        return nil, err
+    }
 
-    // First, count total files for progress bar
-    var totalFiles int64
-    err := filepath.Walk(a.config.Path, func(path string, info os.FileInfo, err error) error {
+    if diffArgs := a.diffArgs(); diffArgs != nil {
+        files, err = a.filterChanged(files, diffArgs)
         if err != nil {
-            return err
+            return nil, err
         }
-        if !info.IsDir() && a.shouldProcessFile(path, info) {
-            totalFiles++
+    }
+
+    if a.selection != nil {
+        var selected []FileEntry
+        for _, f := range files {
+            if a.selection[f.Path] {
+                selected = append(selected, f)
+            }
         }
-        return nil
-    })
+        files = selected
+    }
+    return files, nil
+}
+
+// diffArgs returns the git diff arguments describing the changes selected by
+// --changed-since, --staged and --unstaged, or nil when none of them is set.
+func (a *Analyzer) diffArgs() []string {
+    switch {
+    case a.config.ChangedSince != "":
+        if a.config.GitRef != "" {
+            return []string{a.config.ChangedSince, a.config.GitRef}
+        }
+        return []string{a.config.ChangedSince}
+    case a.config.Staged && a.config.Unstaged:
+        return []string{"HEAD"}
+    case a.config.Staged:
+        return []string{"--cached"}
+    case a.config.Unstaged:
+        return []string{}
+    }
+    return nil
+}
+
+func (a *Analyzer) diffOptions() []string {
+    opts := []string{fmt.Sprintf("-U%d", a.config.DiffContext)}
+    if a.config.FuncContext {
+        opts = append(opts, "--function-context")
+    }
+    return opts
+}
+
+func (a *Analyzer) filterChanged(files []FileEntry, diffArgs []string) ([]FileEntry, error) {
+    changed, err := a.git.ChangedFiles(diffArgs...)
     if err != nil {
         return nil, err
     }
 
-    // Create progress tracker
-    progress := NewProgressTracker(totalFiles, "Analyzing files")
+    changedSet := make(map[string]bool, len(changed))
+    for _, p := range changed {
+        changedSet[filepath.FromSlash(p)] = true
+    }
 
-    go func() {
-        for entry := range entriesChan {
-            entries = append(entries, entry)
+    var filtered []FileEntry
+    for _, f := range files {
+        if changedSet[f.Path] {
+            filtered = append(filtered, f)
         }
-        done <- true
-    }()
+    }
+    return filtered, nil
+}
+
+// Header returns the text to print ahead of the file contents, currently the
+// commit log of the --changed-since range.
+func (a *Analyzer) Header() (string, error) {
+    if a.config.ChangedSince == "" {
+        return "", nil
+    }
 
-    err = filepath.Walk(a.config.Path, func(path string, info os.FileInfo, err error) error {
+    target := "HEAD"
+    if a.config.GitRef != "" {
+        target = a.config.GitRef
+    }
+    revRange := a.config.ChangedSince + ".." + target
+
+    log, err := a.git.Log(revRange)
+    if err != nil {
+        return "", err
+    }
+    if log == "" {
+        return "", nil
+    }
+
+    commits := strings.Count(log, "\n")
+    var buf strings.Builder
+    fmt.Fprintf(&buf, "Changes in %s (%d commits):\n", revRange, commits)
+    buf.WriteString(log)
+    return buf.String(), nil
+}
+
+func (a *Analyzer) walkFiles() ([]FileEntry, error) {
+    var files []FileEntry
+    err := filepath.Walk(a.config.Path, func(path string, info os.FileInfo, err error) error {
         if err != nil {
             return err
         }
-        
-        if relPath, err := filepath.Rel(a.config.Path, path); err == nil {
-            if strings.Count(relPath, string(os.PathSeparator)) > a.config.MaxDepth {
-                if info.IsDir() {
-                    return filepath.SkipDir
-                }
-                return nil
+
+        relPath, err := filepath.Rel(a.config.Path, path)
+        if err != nil {
+            return err
+        }
+        if strings.Count(relPath, string(os.PathSeparator)) > a.config.MaxDepth {
+            if info.IsDir() {
+                return filepath.SkipDir
             }
+            return nil
         }
 
         if info.IsDir() {
+            if info.Name() == ".peeker" && path != a.config.Path {
+                return filepath.SkipDir
+            }
             return nil
         }
 
-        if !a.shouldProcessFile(path, info) {
-            return nil
+        if a.shouldProcessFile(path, info.Size()) {
+            files = append(files, FileEntry{Path: relPath, Size: info.Size()})
         }
+        return nil
+    })
+    return files, err
+}
 
-        wg.Add(1)
-        go func(p string) {
-            defer wg.Done()
-            if entry, err := a.processFile(p); err != nil {
-                errorsChan <- err
-            } else {
-                entriesChan <- entry
-                progress.IncrementFiles(1)
+func (a *Analyzer) listGitFiles() ([]FileEntry, error) {
+    var tracked []GitFile
+    if a.config.GitRef != "" {
+        files, err := a.git.FilesAt(a.config.GitRef)
+        if err != nil {
+            return nil, err
+        }
+        tracked = files
+    } else {
+        paths, err := a.git.TrackedFiles()
+        if err != nil {
+            return nil, err
+        }
+        for _, p := range paths {
+            info, err := os.Stat(filepath.Join(a.config.Path, filepath.FromSlash(p)))
+            if err != nil || info.IsDir() {
+                // Deleted in the working tree, or a submodule
+                continue
             }
-        }(path)
+            tracked = append(tracked, GitFile{Path: p, Size: info.Size()})
+        }
+    }
 
-        return nil
-    })
+    var files []FileEntry
+    for _, f := range tracked {
+        relPath := filepath.FromSlash(f.Path)
+        if strings.Count(relPath, string(os.PathSeparator)) > a.config.MaxDepth {
+            continue
+        }
+        if a.shouldProcessFile(filepath.Join(a.config.Path, relPath), f.Size) {
+            files = append(files, FileEntry{Path: relPath, Size: f.Size})
+        }
+    }
+    return files, nil
+}
 
+func (a *Analyzer) CollectFiles() ([]FileEntry, error) {
+    candidates, err := a.ListFiles()
     if err != nil {
         return nil, err
     }
 
+    if skipped := a.SensitiveSkipped(); len(skipped) > 0 {
+        fmt.Fprintf(os.Stderr, "Warning: skipped %d sensitive files (%s); use --allow-sensitive to include them\n",
+            len(skipped), strings.Join(skipped, ", "))
+    }
+
+    return a.collect(candidates), nil
+}
+
+func (a *Analyzer) relPath(path string) string {
+    if relPath, err := filepath.Rel(a.config.Path, path); err == nil {
+        return relPath
+    }
+    return path
+}
+
+// threads returns how many files to process at once, as set by --threads.
+func (a *Analyzer) threads() int {
+    if a.config.Threads > 0 {
+        return a.config.Threads
+    }
+    return runtime.NumCPU()
+}
+
+// collect reads and tokenizes the listed candidates, reporting those that
+// are skipped or fail.
+func (a *Analyzer) collect(candidates []FileEntry) []FileEntry {
+    var entries []FileEntry
+    var wg sync.WaitGroup
+    var skippedMu sync.Mutex
+    skipped := make(map[string]int)
+    var reasons []string
+    entriesChan := make(chan FileEntry)
+    done := make(chan bool)
+
+    // Create progress tracker
+    progress := NewProgressTracker(int64(len(candidates)), "Analyzing files")
+
+    go func() {
+        for entry := range entriesChan {
+            entries = append(entries, entry)
+        }
+        done <- true
+    }()
+
+    paths := make(chan string)
+    for i := 0; i < a.threads(); i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for p := range paths {
+                entry, err := a.processFile(p)
+                var skipErr *SkipError
+                switch {
+                case errors.As(err, &skipErr):
+                    skippedMu.Lock()
+                    skipped[skipErr.Kind]++
+                    if a.config.Verbose {
+                        reasons = append(reasons, fmt.Sprintf("  %s: %v", a.relPath(p), skipErr))
+                    }
+                    skippedMu.Unlock()
+                    progress.IncrementFiles(1)
+                case err != nil:
+                    fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", p, err)
+                default:
+                    printWarnings(entry)
+                    entriesChan <- entry
+                    progress.IncrementFiles(1)
+                }
+            }
+        }()
+    }
+    for _, candidate := range candidates {
+        paths <- filepath.Join(a.config.Path, candidate.Path)
+    }
+    close(paths)
+
     go func() {
         wg.Wait()
         close(entriesChan)
@@ -292,5 +665,23 @@ func (a *Analyzer) CollectFiles() ([]FileEntry, error) {
     <-done
     progress.Finish()
 
-    return entries, nil
-}
\ No newline at end of file
+    if len(skipped) > 0 {
+        kinds := make([]string, 0, len(skipped))
+        for kind, count := range skipped {
+            kinds = append(kinds, fmt.Sprintf("%d %s", count, kind))
+        }
+        sort.Strings(kinds)
+        if a.config.Verbose {
+            sort.Strings(reasons)
+            fmt.Fprintf(os.Stderr, "Skipped %s files:\n%s\n", strings.Join(kinds, ", "), strings.Join(reasons, "\n"))
+        } else {
+            fmt.Fprintf(os.Stderr, "Skipped %s files (use --verbose to list them)\n", strings.Join(kinds, ", "))
+        }
+    }
+
+    sort.Slice(entries, func(i, j int) bool {
+        return entries[i].Path < entries[j].Path
+    })
+
+    return entries
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reducers that trade fidelity for tokens. They work on lines and a small
+// lexer rather than real parsers, so they err on the side of leaving code in.
+
+type commentSyntax struct {
+    line         []string
+    blockStart   string
+    blockEnd     string
+    quotes       string
+    tripleQuotes bool
+    // charQuotes marks ' as delimiting char literals but also lifetimes, as
+    // in Rust, so it only starts a literal when one closes right after
+    charQuotes bool
+    // regexLiterals marks / as starting a regex literal where an operand is
+    // expected, as in JavaScript
+    regexLiterals bool
+}
+
+var (
+    cComments    = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+    jsComments   = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`", regexLiterals: true}
+    hashComments = commentSyntax{line: []string{"#"}, quotes: "\"'"}
+    xmlComments  = commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+)
+
+var commentSyntaxes = map[string]commentSyntax{
+    "Go":               cComments,
+    "JavaScript":       jsComments,
+    "TypeScript":       jsComments,
+    "Java":             cComments,
+    "Kotlin":           cComments,
+    "Scala":            cComments,
+    "C":                cComments,
+    "C++":              cComments,
+    "C#":               cComments,
+    "Objective-C":      cComments,
+    "Swift":            cComments,
+    "Dart":             cComments,
+    "Groovy":           cComments,
+    "Zig":              {line: []string{"//"}, quotes: "\"'"},
+    "Rust":             {line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"", charQuotes: true},
+    "PHP":              {line: []string{"//", "#"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'"},
+    "Terraform":        {line: []string{"#", "//"}, blockStart: "/*", blockEnd: "*/", quotes: "\""},
+    "Protocol Buffers": {line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'"},
+    "CSS":              {blockStart: "/*", blockEnd: "*/", quotes: "\"'"},
+    "SCSS":             {line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'"},
+    "Less":             {line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'"},
+    "Python":           {line: []string{"#"}, quotes: "\"'", tripleQuotes: true},
+    "Ruby":             hashComments,
+    "Shell":            hashComments,
+    "Perl":             hashComments,
+    "R":                hashComments,
+    "Elixir":           hashComments,
+    "PowerShell":       hashComments,
+    "Starlark":         hashComments,
+    "YAML":             hashComments,
+    "TOML":             hashComments,
+    "Makefile":         {line: []string{"#"}},
+    "Dockerfile":       {line: []string{"#"}},
+    "CMake":            hashComments,
+    "SQL":              {line: []string{"--"}, blockStart: "/*", blockEnd: "*/", quotes: "'\""},
+    "Lua":              {line: []string{"--"}, blockStart: "--[[", blockEnd: "]]", quotes: "\"'"},
+    "Haskell":          {line: []string{"--"}, blockStart: "{-", blockEnd: "-}", quotes: "\""},
+    "HTML":             xmlComments,
+    "XML":              xmlComments,
+    "Markdown":         xmlComments,
+    "Vue":              xmlComments,
+    "Svelte":           xmlComments,
+}
+
+func init() {
+    RegisterTransform(transformFunc{"strip-comments", stripComments})
+    RegisterTransform(transformFunc{"strip-license", stripLicenseHeader})
+    RegisterTransform(transformFunc{"strip-docstrings", stripDocstrings})
+    RegisterTransform(transformFunc{"drop-imports", dropImports})
+}
+
+// stripComments removes comments while leaving string literals alone. Lines
+// that held nothing but a comment are dropped entirely.
+func stripComments(content, language string) string {
+    syntax, ok := commentSyntaxes[language]
+    if !ok {
+        return content
+    }
+
+    var out, line strings.Builder
+    lineHadComment := false
+    flushLine := func(newline bool) {
+        text := line.String()
+        line.Reset()
+        if lineHadComment {
+            lineHadComment = false
+            text = strings.TrimRight(text, " \t")
+            if strings.TrimSpace(text) == "" {
+                return
+            }
+        }
+        out.WriteString(text)
+        if newline {
+            out.WriteByte('\n')
+        }
+    }
+
+    i := 0
+    if strings.HasPrefix(content, "#!") {
+        // Keep the shebang
+        end := strings.IndexByte(content, '\n')
+        if end < 0 {
+            return content
+        }
+        out.WriteString(content[:end+1])
+        i = end + 1
+    }
+
+    for i < len(content) {
+        c := content[i]
+        switch {
+        case c == '\n':
+            flushLine(true)
+            i++
+
+        case syntax.blockStart != "" && strings.HasPrefix(content[i:], syntax.blockStart):
+            end := strings.Index(content[i+len(syntax.blockStart):], syntax.blockEnd)
+            if end < 0 {
+                // Most likely something the lexer does not know, so keep
+                // the rest rather than lose it
+                line.WriteString(content[i:])
+                i = len(content)
+                continue
+            }
+            comment := content[i : i+len(syntax.blockStart)+end+len(syntax.blockEnd)]
+            i += len(comment)
+            for n := strings.Count(comment, "\n"); n > 0; n-- {
+                lineHadComment = true
+                flushLine(true)
+            }
+            lineHadComment = true
+
+        case isLineComment(content, i, syntax):
+            if end := strings.IndexByte(content[i:], '\n'); end < 0 {
+                i = len(content)
+            } else {
+                i += end
+            }
+            lineHadComment = true
+
+        case isLiteralStart(content, i, syntax):
+            end := skipLiteral(content, i, syntax)
+            line.WriteString(content[i:end])
+            i = end
+
+        default:
+            line.WriteByte(c)
+            i++
+        }
+    }
+    flushLine(false)
+
+    return out.String()
+}
+
+func isLineComment(content string, i int, syntax commentSyntax) bool {
+    for _, marker := range syntax.line {
+        if !strings.HasPrefix(content[i:], marker) {
+            continue
+        }
+        // In shell-like languages # is only a comment at the start of a word
+        if marker == "#" && i > 0 && !strings.ContainsRune(" \t\n;", rune(content[i-1])) {
+            continue
+        }
+        return true
+    }
+    return false
+}
+
+func isLiteralStart(content string, i int, syntax commentSyntax) bool {
+    if syntax.charQuotes && content[i] == '\'' {
+        return charLiteralEnd(content, i) >= 0
+    }
+    if syntax.regexLiterals && content[i] == '/' {
+        return regexLiteralEnd(content, i) >= 0
+    }
+    return strings.IndexByte(syntax.quotes, content[i]) >= 0
+}
+
+// skipLiteral returns the index just past the string, char or regex literal
+// starting at i.
+func skipLiteral(content string, i int, syntax commentSyntax) int {
+    if syntax.charQuotes && content[i] == '\'' {
+        return charLiteralEnd(content, i)
+    }
+    if syntax.regexLiterals && content[i] == '/' {
+        return regexLiteralEnd(content, i)
+    }
+    return skipString(content, i, syntax.tripleQuotes)
+}
+
+// charLiteralEnd returns the index just past a char literal such as 'x',
+// '\'' or '\u{1F600}' starting at i, or -1 if the quote starts something
+// else, such as the lifetime 'a.
+func charLiteralEnd(content string, i int) int {
+    j := i + 1
+    if j >= len(content) {
+        return -1
+    }
+    if content[j] == '\\' {
+        switch {
+        case strings.HasPrefix(content[j:], `\u{`):
+            end := strings.IndexByte(content[j:], '}')
+            if end < 0 {
+                return -1
+            }
+            j += end + 1
+        case strings.HasPrefix(content[j:], `\x`):
+            j += 4
+        default:
+            j += 2
+        }
+    } else {
+        _, size := utf8.DecodeRuneInString(content[j:])
+        j += size
+    }
+    if j < len(content) && content[j] == '\'' {
+        return j + 1
+    }
+    return -1
+}
+
+var regexKeywords = map[string]bool{
+    "return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+    "delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+    "yield": true, "await": true,
+}
+
+// regexLiteralEnd returns the index just past a regex literal such as
+// /\/*x/g starting at i, or -1 if the slash is a division or a comment. Like
+// JavaScript's own grammar, it decides by what comes before: a regex can
+// only stand where an operand is expected.
+func regexLiteralEnd(content string, i int) int {
+    if i+1 >= len(content) || content[i+1] == '/' || content[i+1] == '*' {
+        return -1
+    }
+
+    j := i - 1
+    for j >= 0 && (content[j] == ' ' || content[j] == '\t') {
+        j--
+    }
+    if j >= 0 && content[j] != '\n' {
+        switch c := content[j]; {
+        case c == ')' || c == ']' || c == '}' || c == '"' || c == '\'' || c == '`':
+            return -1
+        case isIdentByte(c):
+            start := j
+            for start > 0 && isIdentByte(content[start-1]) {
+                start--
+            }
+            if !regexKeywords[content[start:j+1]] {
+                return -1
+            }
+        }
+    }
+
+    inClass := false
+    for j = i + 1; j < len(content); j++ {
+        switch content[j] {
+        case '\\':
+            j++
+        case '[':
+            inClass = true
+        case ']':
+            inClass = false
+        case '\n':
+            return -1
+        case '/':
+            if !inClass {
+                for j++; j < len(content) && isIdentByte(content[j]); j++ {
+                }
+                return j
+            }
+        }
+    }
+    return -1
+}
+
+func isIdentByte(c byte) bool {
+    return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// skipString returns the index just past the string literal starting at i.
+func skipString(content string, i int, tripleQuotes bool) int {
+    delim := content[i : i+1]
+    if tripleQuotes && (strings.HasPrefix(content[i:], `"""`) || strings.HasPrefix(content[i:], `'''`)) {
+        delim = content[i : i+3]
+    }
+
+    for j := i + len(delim); j < len(content); j++ {
+        switch {
+        case content[j] == '\\' && delim != "`":
+            j++
+        case strings.HasPrefix(content[j:], delim):
+            return j + len(delim)
+        case content[j] == '\n' && len(delim) == 1 && delim != "`":
+            // Unterminated single-line literal, e.g. an apostrophe in prose
+            return j
+        }
+    }
+    return len(content)
+}
+
+var licenseRe = regexp.MustCompile(`(?i)copyright|license|licence|spdx-license-identifier|\(c\)`)
+
+// stripLicenseHeader removes a leading comment block that mentions a
+// copyright or license.
+func stripLicenseHeader(content, language string) string {
+    syntax, ok := commentSyntaxes[language]
+    if !ok {
+        return content
+    }
+
+    lines := strings.Split(content, "\n")
+    start := 0
+    if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+        start = 1
+    }
+    for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+        start++
+    }
+    if start == len(lines) {
+        return content
+    }
+
+    end := start
+    first := strings.TrimSpace(lines[start])
+    switch {
+    case syntax.blockStart != "" && strings.HasPrefix(first, syntax.blockStart):
+        for end < len(lines) && !strings.Contains(lines[end], syntax.blockEnd) {
+            end++
+        }
+        if end == len(lines) {
+            return content
+        }
+        end++
+    case hasLinePrefix(first, syntax.line):
+        for end < len(lines) && hasLinePrefix(strings.TrimSpace(lines[end]), syntax.line) {
+            end++
+        }
+    default:
+        return content
+    }
+
+    if !licenseRe.MatchString(strings.Join(lines[start:end], "\n")) {
+        return content
+    }
+
+    // Take the blank line that usually separates the header with it
+    if end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+        end++
+    }
+    return strings.Join(append(lines[:start:start], lines[end:]...), "\n")
+}
+
+func hasLinePrefix(line string, markers []string) bool {
+    for _, marker := range markers {
+        if strings.HasPrefix(line, marker) {
+            return true
+        }
+    }
+    return false
+}
+
+var (
+    pyBlockOpenerRe = regexp.MustCompile(`^\s*(async\s+def|def|class)\b.*:\s*(#.*)?$`)
+    pyDocstringRe   = regexp.MustCompile(`^\s*[rRuUbB]{0,2}("""|''')`)
+    goDeclRe        = regexp.MustCompile(`^(package|func|type|var|const)\b|^\s+[A-Z]\w*(\s|\()`)
+)
+
+// stripDocstrings removes documentation rather than all comments: Python
+// docstrings, /** */ blocks, Rust and C# /// comments, and Go doc comments.
+func stripDocstrings(content, language string) string {
+    lines := strings.Split(content, "\n")
+    var out []string
+
+    switch language {
+    case "Python":
+        atModuleStart := true
+        prevOpener := false
+        for i := 0; i < len(lines); i++ {
+            line := lines[i]
+            trimmed := strings.TrimSpace(line)
+            if m := pyDocstringRe.FindStringSubmatch(line); m != nil && (prevOpener || atModuleStart) {
+                delim := m[1]
+                rest := trimmed[strings.Index(trimmed, delim)+3:]
+                if !strings.Contains(rest, delim) {
+                    for i++; i < len(lines) && !strings.Contains(lines[i], delim); i++ {
+                    }
+                }
+                atModuleStart, prevOpener = false, false
+                continue
+            }
+            if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+                atModuleStart = false
+                prevOpener = pyBlockOpenerRe.MatchString(line)
+            }
+            out = append(out, line)
+        }
+
+    case "Go":
+        for i := 0; i < len(lines); i++ {
+            if !strings.HasPrefix(strings.TrimSpace(lines[i]), "//") {
+                out = append(out, lines[i])
+                continue
+            }
+            end := i
+            for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "//") {
+                end++
+            }
+            if end < len(lines) && goDeclRe.MatchString(lines[end]) {
+                i = end - 1
+                continue
+            }
+            out = append(out, lines[i:end]...)
+            i = end - 1
+        }
+
+    default:
+        if syntax, ok := commentSyntaxes[language]; !ok || syntax.blockStart != "/*" {
+            return content
+        }
+        inDoc := false
+        for _, line := range lines {
+            trimmed := strings.TrimSpace(line)
+            switch {
+            case inDoc:
+                if strings.Contains(trimmed, "*/") {
+                    inDoc = false
+                }
+            case strings.HasPrefix(trimmed, "/**") && trimmed != "/**/":
+                inDoc = !strings.Contains(trimmed[3:], "*/")
+            case strings.HasPrefix(trimmed, "///") || strings.HasPrefix(trimmed, "//!"):
+            default:
+                out = append(out, line)
+            }
+        }
+    }
+
+    return strings.Join(out, "\n")
+}
+
+var (
+    goImportRe   = regexp.MustCompile(`^import(\s|\()`)
+    jsImportRe   = regexp.MustCompile(`^import[\s{*]`)
+    pyImportRe   = regexp.MustCompile(`^(import\s|from\s+\S+\s+import\b)`)
+    javaImportRe = regexp.MustCompile(`^import\s+[\w.*\s]+;?\s*$`)
+    rustUseRe    = regexp.MustCompile(`^(pub(\([^)]*\))?\s+)?use\s|^extern\s+crate\s`)
+    cIncludeRe   = regexp.MustCompile(`^#\s*(include|import)\b`)
+    csUsingRe    = regexp.MustCompile(`^(global\s+)?using\s+[\w.=\s]+;\s*$`)
+)
+
+// dropImports removes import statements, which rarely matter to a reader who
+// can see the code that uses them.
+func dropImports(content, language string) string {
+    lines := strings.Split(content, "\n")
+    var out []string
+
+    for i := 0; i < len(lines); i++ {
+        trimmed := strings.TrimSpace(lines[i])
+        // Only look at top-level statements
+        indented := len(lines[i]) > 0 && (lines[i][0] == ' ' || lines[i][0] == '\t')
+
+        switch {
+        case language == "Go" && !indented && goImportRe.MatchString(trimmed):
+            if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(trimmed, "import")), "(") {
+                for i < len(lines) && strings.TrimSpace(lines[i]) != ")" {
+                    i++
+                }
+            }
+            continue
+
+        case language == "Python" && !indented && pyImportRe.MatchString(trimmed):
+            if strings.Contains(trimmed, "(") && !strings.Contains(trimmed, ")") {
+                for i < len(lines) && !strings.Contains(lines[i], ")") {
+                    i++
+                }
+            } else {
+                for i < len(lines) && strings.HasSuffix(strings.TrimSpace(lines[i]), "\\") {
+                    i++
+                }
+            }
+            continue
+
+        case (language == "JavaScript" || language == "TypeScript") && !indented && jsImportRe.MatchString(trimmed):
+            if end := importEnd(lines, i, language); end >= 0 {
+                i = end
+                continue
+            }
+
+        case (language == "Java" || language == "Kotlin" || language == "Scala" || language == "Groovy" || language == "Dart") &&
+            !indented && (javaImportRe.MatchString(trimmed) || (language == "Dart" && strings.HasPrefix(trimmed, "import "))):
+            continue
+
+        case language == "Rust" && !indented && rustUseRe.MatchString(trimmed):
+            if end := importEnd(lines, i, language); end >= 0 {
+                i = end
+                continue
+            }
+
+        case (language == "C" || language == "C++" || language == "Objective-C") && cIncludeRe.MatchString(trimmed):
+            continue
+
+        case language == "C#" && !indented && csUsingRe.MatchString(trimmed):
+            continue
+        }
+
+        out = append(out, lines[i])
+    }
+
+    return strings.Join(out, "\n")
+}
+
+// importEnd returns the index of the last line of the JavaScript import or
+// Rust use statement starting at lines[i]. It only reads on while a { is
+// open, or for JavaScript into a "from" clause on the next line, and returns
+// -1 if the braces never close so that nothing is dropped.
+func importEnd(lines []string, i int, language string) int {
+    syntax := commentSyntaxes[language]
+    depth := 0
+    for ; i < len(lines); i++ {
+        code := stripLineComment(lines[i], syntax)
+        depth += strings.Count(code, "{") - strings.Count(code, "}")
+        if depth > 0 {
+            continue
+        }
+        if language != "Rust" && i+1 < len(lines) && jsFromRe.MatchString(strings.TrimSpace(lines[i+1])) {
+            continue
+        }
+        return i
+    }
+    return -1
+}
+
+var jsFromRe = regexp.MustCompile(`^from\s*['"]`)
+
+// stripLineComment cuts a trailing line comment off line, leaving any
+// comment markers inside string literals alone.
+func stripLineComment(line string, syntax commentSyntax) string {
+    for i := 0; i < len(line); {
+        switch {
+        case isLineComment(line, i, syntax):
+            return line[:i]
+        case isLiteralStart(line, i, syntax):
+            i = skipLiteral(line, i, syntax)
+        default:
+            i++
+        }
+    }
+    return line
+}
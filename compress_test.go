@@ -0,0 +1,141 @@
+package main
+
+import "testing"
+
+func TestReducers(t *testing.T) {
+    tests := []struct {
+        name     string
+        reduce   func(string, string) string
+        language string
+        input    string
+        want     string
+    }{
+        {
+            name:     "go comments outside strings",
+            reduce:   stripComments,
+            language: "Go",
+            input:    "package p // trailing\n\n// whole line\nvar s = \"// not a comment\" /* block */ + `/* raw */`\n/*\nmulti\n*/\nvar x = 1\n",
+            want:     "package p\n\nvar s = \"// not a comment\"  + `/* raw */`\nvar x = 1\n",
+        },
+        {
+            name:     "python comments",
+            reduce:   stripComments,
+            language: "Python",
+            input:    "x = '#'  # c\ny = 1\n",
+            want:     "x = '#'\ny = 1\n",
+        },
+        {
+            name:     "rust comments after char literals and lifetimes",
+            reduce:   stripComments,
+            language: "Rust",
+            input:    "let q = '\"'; // quote char\nlet s = \"//\"; let l: &'a str = s; // c\n",
+            want:     "let q = '\"';\nlet s = \"//\"; let l: &'a str = s;\n",
+        },
+        {
+            name:     "javascript regex literals are not comments",
+            reduce:   stripComments,
+            language: "JavaScript",
+            input:    "const re = /\\/*x/g; // slashes\nif (/[/*]/.test(s)) { return a / b / c; } /* c */\nreturn x;\n",
+            want:     "const re = /\\/*x/g;\nif (/[/*]/.test(s)) { return a / b / c; }\nreturn x;\n",
+        },
+        {
+            name:     "unclosed block comment is kept",
+            reduce:   stripComments,
+            language: "Go",
+            input:    "x := 1 // one\ny := 2 /* never closed\nz := 3\n",
+            want:     "x := 1\ny := 2 /* never closed\nz := 3\n",
+        },
+        {
+            name:     "line comment license header",
+            reduce:   stripLicenseHeader,
+            language: "Go",
+            input:    "// Copyright 2024 Acme\n// SPDX-License-Identifier: MIT\n\npackage p\n",
+            want:     "package p\n",
+        },
+        {
+            name:     "block comment license header",
+            reduce:   stripLicenseHeader,
+            language: "JavaScript",
+            input:    "/*\n * Licensed under MIT\n */\n\nexport const a = 1;\n",
+            want:     "export const a = 1;\n",
+        },
+        {
+            name:     "package doc is not a license",
+            reduce:   stripLicenseHeader,
+            language: "Go",
+            input:    "// Package p does things.\npackage p\n",
+            want:     "// Package p does things.\npackage p\n",
+        },
+        {
+            name:     "python docstrings but not other strings",
+            reduce:   stripDocstrings,
+            language: "Python",
+            input:    "\"\"\"Module doc.\"\"\"\nimport os\n\ndef f():\n    \"\"\"Doc\n    more.\n    \"\"\"\n    x = \"\"\"not a doc\"\"\"\n    return x\n",
+            want:     "import os\n\ndef f():\n    x = \"\"\"not a doc\"\"\"\n    return x\n",
+        },
+        {
+            name:     "go imports",
+            reduce:   dropImports,
+            language: "Go",
+            input:    "package p\n\nimport \"fmt\"\n\nimport (\n\t\"os\"\n)\n\nfunc f() {}\n",
+            want:     "package p\n\n\n\nfunc f() {}\n",
+        },
+        {
+            name:     "python top-level imports only",
+            reduce:   dropImports,
+            language: "Python",
+            input:    "import os\nfrom x import (\n    a,\n    b,\n)\n\ndef f():\n    import json\n",
+            want:     "\ndef f():\n    import json\n",
+        },
+        {
+            name:     "rust use declarations",
+            reduce:   dropImports,
+            language: "Rust",
+            input:    "use std::io;\npub use a::{\n    b,\n};\nfn main() {}\n",
+            want:     "fn main() {}\n",
+        },
+        {
+            name:     "javascript imports but not dynamic import or import.meta",
+            reduce:   dropImports,
+            language: "JavaScript",
+            input:    "import x from 'y';\nimport {\n  a,\n  b,\n} from \"z\";\nimport * as m from 'm'\nimport './side.css';\nimport('./lazy').then(m => {\n  m.run();\n});\nconst u = import.meta.url;\n",
+            want:     "import('./lazy').then(m => {\n  m.run();\n});\nconst u = import.meta.url;\n",
+        },
+        {
+            name:     "javascript imports with trailing comments",
+            reduce:   dropImports,
+            language: "JavaScript",
+            input:    "import {\n  a, // first\n} from 'http://x/y.js' // remote\nimport z\n  from 'z';\nimport React from 'react'; // ui\nfunction f() {\n  return 1;\n}\n",
+            want:     "function f() {\n  return 1;\n}\n",
+        },
+        {
+            name:     "typescript import require",
+            reduce:   dropImports,
+            language: "TypeScript",
+            input:    "import fs = require(\"fs\");\nexport function f() {\n  return fs;\n}\n",
+            want:     "export function f() {\n  return fs;\n}\n",
+        },
+        {
+            name:     "rust use with a trailing comment",
+            reduce:   dropImports,
+            language: "Rust",
+            input:    "use std::{\n    fs, // files\n};\nuse std::io; // io\nfn main() {\n}\n",
+            want:     "fn main() {\n}\n",
+        },
+        {
+            name:     "unclosed import braces are kept",
+            reduce:   dropImports,
+            language: "JavaScript",
+            input:    "import {\n  a,\nconst b = 1;\n",
+            want:     "import {\n  a,\nconst b = 1;\n",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.reduce(tt.input, tt.language); got != tt.want {
+                t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+            }
+        })
+    }
+}
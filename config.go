@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileConfig holds settings read from config files rather than flags. The
+// user's ~/.config/peeker/config.json is read first, then the project's
+// .peeker/config.json, whose settings take precedence.
+type FileConfig struct {
+    Keymap string              `json:"keymap"`
+    Keys   map[string][]string `json:"keys"`
+    Theme  string              `json:"theme"`
+    Colors map[string]string   `json:"colors"`
+}
+
+func configFiles(root string) []string {
+    var files []string
+    if dir, err := os.UserConfigDir(); err == nil {
+        files = append(files, filepath.Join(dir, "peeker", "config.json"))
+    }
+    return append(files, filepath.Join(root, ".peeker", "config.json"))
+}
+
+func LoadFileConfig(root string) (*FileConfig, error) {
+    merged := &FileConfig{
+        Keys:   make(map[string][]string),
+        Colors: make(map[string]string),
+    }
+
+    for _, file := range configFiles(root) {
+        data, err := os.ReadFile(file)
+        if errors.Is(err, os.ErrNotExist) {
+            continue
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read config: %w", err)
+        }
+
+        var fc FileConfig
+        if err := json.Unmarshal(data, &fc); err != nil {
+            return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+        }
+        if fc.Keymap != "" {
+            merged.Keymap = fc.Keymap
+        }
+        if fc.Theme != "" {
+            merged.Theme = fc.Theme
+        }
+        for action, keys := range fc.Keys {
+            merged.Keys[action] = keys
+        }
+        for role, color := range fc.Colors {
+            merged.Colors[role] = color
+        }
+    }
+
+    return merged, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SkipError is returned by processFile for files that were deliberately left
+// out of the results, as opposed to files that could not be read.
+type SkipError struct {
+    Kind   string
+    Reason string
+}
+
+func (e *SkipError) Error() string {
+    return fmt.Sprintf("%s (%s)", e.Kind, e.Reason)
+}
+
+var magicNumbers = []struct {
+    magic []byte
+    name  string
+}{
+    {[]byte("\x7fELF"), "ELF executable"},
+    {[]byte{0xFE, 0xED, 0xFA, 0xCE}, "Mach-O binary"},
+    {[]byte{0xFE, 0xED, 0xFA, 0xCF}, "Mach-O binary"},
+    {[]byte{0xCF, 0xFA, 0xED, 0xFE}, "Mach-O binary"},
+    {[]byte{0xCA, 0xFE, 0xBA, 0xBE}, "Java class or Mach-O universal binary"},
+    {[]byte("\x00asm"), "WebAssembly module"},
+    {[]byte("SQLite format 3\x00"), "SQLite database"},
+    {[]byte("7z\xBC\xAF\x27\x1C"), "7-Zip archive"},
+    {[]byte("Rar!\x1A\x07"), "RAR archive"},
+    {[]byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, "xz archive"},
+    {[]byte{0x28, 0xB5, 0x2F, 0xFD}, "zstd archive"},
+    {[]byte("\x89HDF\r\n\x1a\n"), "HDF5 file"},
+    {[]byte("!<arch>\n"), "ar archive"},
+}
+
+// detectBinary decides whether the first bytes of a file belong to a binary
+// format, returning a description of the format if so.
+func detectBinary(head []byte) (bool, string) {
+    if len(head) == 0 {
+        return false, ""
+    }
+
+    // Wide Unicode text is full of NUL bytes, so trust a byte order mark
+    if sniffEncoding(head) != "" {
+        return false, ""
+    }
+
+    for _, m := range magicNumbers {
+        if bytes.HasPrefix(head, m.magic) {
+            return true, m.name
+        }
+    }
+
+    contentType := http.DetectContentType(head)
+    if mediaType, _, _ := strings.Cut(contentType, ";"); !strings.HasPrefix(mediaType, "text/") &&
+        mediaType != "application/octet-stream" && mediaType != "application/json" {
+        return true, mediaType
+    }
+
+    if bytes.IndexByte(head, 0) >= 0 {
+        return true, "contains NUL bytes"
+    }
+
+    if validUTF8Prefix(head) {
+        return false, ""
+    }
+
+    // Not UTF-8, but it may still be text in a legacy encoding as long as it
+    // is not dominated by control characters
+    control := 0
+    for _, b := range head {
+        if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\v' && b != 0x1b {
+            control++
+        }
+    }
+    if control*10 > len(head) {
+        return true, "invalid UTF-8 with control characters"
+    }
+
+    return false, ""
+}
+
+// validUTF8Prefix reports whether head is valid UTF-8, allowing for a
+// multi-byte sequence cut off at the end of the buffer.
+func validUTF8Prefix(head []byte) bool {
+    for cut := 0; cut < utf8.UTFMax && cut < len(head); cut++ {
+        if utf8.Valid(head[:len(head)-cut]) {
+            return true
+        }
+    }
+    return false
+}
+
+var lockfiles = map[string]bool{
+    "go.sum":              true,
+    "package-lock.json":   true,
+    "npm-shrinkwrap.json": true,
+    "yarn.lock":           true,
+    "pnpm-lock.yaml":      true,
+    "bun.lockb":           true,
+    "Cargo.lock":          true,
+    "poetry.lock":         true,
+    "Pipfile.lock":        true,
+    "uv.lock":             true,
+    "composer.lock":       true,
+    "Gemfile.lock":        true,
+    "mix.lock":            true,
+    "flake.lock":          true,
+    "Podfile.lock":        true,
+    "pubspec.lock":        true,
+}
+
+var (
+    goGeneratedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+    sourceMapRe   = regexp.MustCompile(`^\s*\{\s*"version"\s*:\s*3\s*,`)
+)
+
+// leadingComments returns the lines of content that come before its first
+// code, which is where generators put their markers. Go only honors its
+// marker there, ahead of the package clause, so the same text in a string or
+// a later comment does not count.
+func leadingComments(content string) []string {
+    var lines []string
+    inBlock := false
+    for content != "" {
+        var line string
+        line, content, _ = strings.Cut(content, "\n")
+        line = strings.TrimRight(line, "\r")
+
+        trimmed := strings.TrimSpace(line)
+        switch {
+        case inBlock:
+            inBlock = !strings.Contains(trimmed, "*/")
+        case strings.HasPrefix(trimmed, "/*"):
+            inBlock = !strings.Contains(trimmed[2:], "*/")
+        case trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") ||
+            strings.HasPrefix(trimmed, "<!--") || strings.HasPrefix(trimmed, "--"):
+        default:
+            return lines
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+// detectGenerated returns why a file looks machine-generated, or "" if it
+// does not.
+func detectGenerated(path, content string) string {
+    base := filepath.Base(path)
+    if lockfiles[base] {
+        return "lockfile"
+    }
+
+    if strings.HasSuffix(base, ".map") && sourceMapRe.MatchString(content) {
+        return "source map"
+    }
+
+    comments := leadingComments(content)
+    for _, line := range comments {
+        if goGeneratedRe.MatchString(line) {
+            return "code generator header"
+        }
+    }
+
+    if len(comments) > 5 {
+        comments = comments[:5]
+    }
+    header := strings.Join(comments, "\n")
+    lowerHeader := strings.ToLower(header)
+    if strings.Contains(header, "@generated") ||
+        (strings.Contains(lowerHeader, "generated") && strings.Contains(lowerHeader, "do not edit")) {
+        return "code generator header"
+    }
+
+    switch strings.ToLower(filepath.Ext(base)) {
+    case ".js", ".mjs", ".cjs", ".css":
+        if strings.Contains(base, ".min.") || isMinified(content) {
+            return "minified"
+        }
+    }
+
+    return ""
+}
+
+// isMinified looks for the very long lines left behind by minifiers.
+func isMinified(content string) bool {
+    if len(content) < 1024 {
+        return false
+    }
+
+    lines := strings.Count(content, "\n") + 1
+    return len(content)/lines > 500
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectBinary(t *testing.T) {
+    tests := []struct {
+        name   string
+        head   []byte
+        binary bool
+        reason string
+    }{
+        {"empty", nil, false, ""},
+        {"text", []byte("package main\n\nfunc main() {}\n"), false, ""},
+        {"json", []byte(`{"a": [1, 2]}`), false, ""},
+        {"elf", []byte("\x7fELF\x02\x01\x01\x00"), true, "ELF executable"},
+        {"sqlite", []byte("SQLite format 3\x00\x10\x00"), true, "SQLite database"},
+        {"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), true, "image/png"},
+        {"nul bytes", []byte("abc\x00\x01\x02def"), true, "contains NUL bytes"},
+        {"utf-16 with bom", []byte("\xff\xfeh\x00i\x00"), false, ""},
+        {"utf-8 cut mid-rune", []byte("caf\xc3"), false, ""},
+        {"latin-1 text", []byte("caf\xe9 cr\xe8me\n"), false, ""},
+        {"control characters", []byte("\x01\x02\x03\x04\xff\x05\x06\x07\x08"), true, "invalid UTF-8 with control characters"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            binary, reason := detectBinary(tt.head)
+            if binary != tt.binary || reason != tt.reason {
+                t.Errorf("detectBinary(%q) = %v, %q; want %v, %q", tt.head, binary, reason, tt.binary, tt.reason)
+            }
+        })
+    }
+}
+
+func TestDetectGenerated(t *testing.T) {
+    tests := []struct {
+        name    string
+        path    string
+        content string
+        want    string
+    }{
+        {"plain source", "main.go", "package main\n", ""},
+        {"lockfile", "sub/go.sum", "example.com/x v1.0.0 h1:abc=\n", "lockfile"},
+        {"source map", "app.js.map", `{"version":3,"sources":[]}`, "source map"},
+        {"map that is not a source map", "world.map", "xxxx\n", ""},
+        {"go marker", "x.pb.go", "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage x\n", "code generator header"},
+        {"go marker after license", "x.go", "// Copyright 2024\n// License: MIT\n\n// Code generated by stringer. DO NOT EDIT.\n\npackage x\n", "code generator header"},
+        {"go marker in a block comment header", "x.go", "/*\nCopyright\n*/\n// Code generated by x. DO NOT EDIT.\npackage x\n", "code generator header"},
+        {"go marker in a string", "gen.go", "package gen\n\nconst header = `\n// Code generated by gen. DO NOT EDIT.\n`\n", ""},
+        {"go marker in a later comment", "gen.go", "package gen\n\n// Code generated by gen. DO NOT EDIT.\nfunc f() {}\n", ""},
+        {"@generated", "schema.ts", "/**\n * @generated\n */\nexport type A = 1;\n", "code generator header"},
+        {"python header", "x_pb2.py", "# -*- coding: utf-8 -*-\n# Generated by the protocol buffer compiler.  DO NOT EDIT!\nimport sys\n", "code generator header"},
+        {"do not edit in code", "doc.py", "import sys\n\nWARNING = 'generated file, do not edit'\n", ""},
+        {"minified name", "lib.min.js", "var a=1;\n", "minified"},
+        {"minified content", "bundle.js", strings.Repeat("a", 2000), "minified"},
+        {"long lines elsewhere", "data.txt", strings.Repeat("a", 2000), ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := detectGenerated(tt.path, tt.content); got != tt.want {
+                t.Errorf("detectGenerated(%q) = %q, want %q", tt.path, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	xunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+const (
+    EncodingUTF8        = "utf-8"
+    EncodingUTF8BOM     = "utf-8-bom"
+    EncodingUTF16LE     = "utf-16le"
+    EncodingUTF16BE     = "utf-16be"
+    EncodingUTF32LE     = "utf-32le"
+    EncodingUTF32BE     = "utf-32be"
+    EncodingShiftJIS    = "shift_jis"
+    EncodingWindows1252 = "windows-1252"
+)
+
+var boms = []struct {
+    bom      []byte
+    encoding string
+}{
+    // UTF-32LE must come before UTF-16LE, whose BOM is a prefix of it
+    {[]byte{0xFF, 0xFE, 0x00, 0x00}, EncodingUTF32LE},
+    {[]byte{0x00, 0x00, 0xFE, 0xFF}, EncodingUTF32BE},
+    {[]byte{0xEF, 0xBB, 0xBF}, EncodingUTF8BOM},
+    {[]byte{0xFF, 0xFE}, EncodingUTF16LE},
+    {[]byte{0xFE, 0xFF}, EncodingUTF16BE},
+}
+
+// sniffEncoding guesses the encoding of content from a BOM or, for BOM-less
+// UTF-16, from the position of NUL bytes. It returns "" when there is no
+// such signal, in which case decodeText looks at the whole content.
+func sniffEncoding(head []byte) string {
+    for _, b := range boms {
+        if bytes.HasPrefix(head, b.bom) {
+            return b.encoding
+        }
+    }
+
+    // ASCII text in UTF-16 has a NUL in every other byte
+    if len(head) >= 16 {
+        var evenNuls, oddNuls int
+        for i, c := range head {
+            if c == 0 {
+                if i%2 == 0 {
+                    evenNuls++
+                } else {
+                    oddNuls++
+                }
+            }
+        }
+        half := len(head) / 2
+        if oddNuls > half*3/4 && evenNuls == 0 {
+            return EncodingUTF16LE
+        }
+        if evenNuls > half*3/4 && oddNuls == 0 {
+            return EncodingUTF16BE
+        }
+    }
+
+    return ""
+}
+
+// decodeText transcodes raw file content to UTF-8, stripping any BOM. It
+// returns the detected encoding, and an error when the content could not be
+// decoded without loss.
+func decodeText(raw []byte) (string, string, error) {
+    enc := sniffEncoding(raw)
+    if enc == "" {
+        if utf8.Valid(raw) {
+            return string(raw), EncodingUTF8, nil
+        }
+        enc = guessLegacyEncoding(raw)
+    }
+
+    var decoder *encoding.Decoder
+    switch enc {
+    case EncodingUTF8BOM:
+        raw = raw[3:]
+        if !utf8.Valid(raw) {
+            return "", enc, fmt.Errorf("invalid UTF-8 after byte order mark")
+        }
+        return string(raw), enc, nil
+    case EncodingUTF16LE:
+        decoder = xunicode.UTF16(xunicode.LittleEndian, xunicode.UseBOM).NewDecoder()
+    case EncodingUTF16BE:
+        decoder = xunicode.UTF16(xunicode.BigEndian, xunicode.UseBOM).NewDecoder()
+    case EncodingUTF32LE:
+        decoder = utf32.UTF32(utf32.LittleEndian, utf32.UseBOM).NewDecoder()
+    case EncodingUTF32BE:
+        decoder = utf32.UTF32(utf32.BigEndian, utf32.UseBOM).NewDecoder()
+    case EncodingShiftJIS:
+        decoder = japanese.ShiftJIS.NewDecoder()
+    default:
+        decoder = charmap.Windows1252.NewDecoder()
+    }
+
+    decoded, err := decoder.Bytes(raw)
+    if err != nil {
+        return "", enc, fmt.Errorf("failed to decode %s: %w", enc, err)
+    }
+    if bytes.ContainsRune(decoded, utf8.RuneError) {
+        return "", enc, fmt.Errorf("invalid %s byte sequence", enc)
+    }
+
+    return string(decoded), enc, nil
+}
+
+// guessLegacyEncoding picks between the legacy encodings we support for
+// content that is not valid UTF-8. Shift-JIS wins if it decodes cleanly and
+// mostly produces Japanese characters; otherwise Windows-1252, which accepts
+// nearly any byte sequence and is a superset of printable Latin-1.
+func guessLegacyEncoding(raw []byte) string {
+    decoded, err := japanese.ShiftJIS.NewDecoder().String(string(raw))
+    if err == nil && !strings.ContainsRune(decoded, utf8.RuneError) {
+        var nonASCII, japaneseRunes int
+        for _, r := range decoded {
+            if r < utf8.RuneSelf {
+                continue
+            }
+            nonASCII++
+            if unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han) || (r >= 0xFF00 && r <= 0xFFEF) || (r >= 0x3000 && r <= 0x303F) {
+                japaneseRunes++
+            }
+        }
+        if nonASCII > 0 && japaneseRunes*10 >= nonASCII*8 {
+            return EncodingShiftJIS
+        }
+    }
+
+    return EncodingWindows1252
+}
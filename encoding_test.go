@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestDecodeText(t *testing.T) {
+    tests := []struct {
+        name     string
+        raw      string
+        want     string
+        encoding string
+        wantErr  bool
+    }{
+        {"plain utf-8", "héllo\n", "héllo\n", EncodingUTF8, false},
+        {"empty", "", "", EncodingUTF8, false},
+        {"utf-8 with bom", "\xef\xbb\xbfhi\n", "hi\n", EncodingUTF8BOM, false},
+        {"invalid utf-8 after bom", "\xef\xbb\xbfh\xffi", "", EncodingUTF8BOM, true},
+        {"utf-16le with bom", "\xff\xfeh\x00i\x00", "hi", EncodingUTF16LE, false},
+        {"utf-16be with bom", "\xfe\xff\x00h\x00i", "hi", EncodingUTF16BE, false},
+        {"utf-16le without bom", "p\x00a\x00c\x00k\x00a\x00g\x00e\x00 \x00m\x00", "package m", EncodingUTF16LE, false},
+        {"truncated utf-16", "\xff\xfeh\x00i", "", EncodingUTF16LE, true},
+        {"utf-32le with bom", "\xff\xfe\x00\x00h\x00\x00\x00", "h", EncodingUTF32LE, false},
+        {"shift_jis", "// \x93\xfa\x96\x7b\x8c\xea\n", "// 日本語\n", EncodingShiftJIS, false},
+        {"windows-1252", "caf\xe9 \x93quoted\x94\n", "café “quoted”\n", EncodingWindows1252, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, enc, err := decodeText([]byte(tt.raw))
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("decodeText(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+            }
+            if enc != tt.encoding {
+                t.Errorf("decodeText(%q) encoding = %q, want %q", tt.raw, enc, tt.encoding)
+            }
+            if err == nil && got != tt.want {
+                t.Errorf("decodeText(%q) = %q, want %q", tt.raw, got, tt.want)
+            }
+        })
+    }
+}
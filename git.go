@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GitRepo runs git commands against the repository containing dir. All paths
+// passed to and returned from it are relative to dir, not the repository root.
+type GitRepo struct {
+    dir string
+
+    batchOnce sync.Once
+    batch     *blobReader
+    batchErr  error
+}
+
+type GitFile struct {
+    Path string
+    Size int64
+}
+
+func OpenGitRepo(dir string) (*GitRepo, error) {
+    if _, err := exec.LookPath("git"); err != nil {
+        return nil, fmt.Errorf("git executable not found: %w", err)
+    }
+
+    repo := &GitRepo{dir: dir}
+    if _, err := repo.run("rev-parse", "--git-dir"); err != nil {
+        return nil, fmt.Errorf("'%s' is not inside a git repository: %w", dir, err)
+    }
+    return repo, nil
+}
+
+func (g *GitRepo) run(args ...string) ([]byte, error) {
+    cmd := exec.Command("git", append([]string{"-C", g.dir}, args...)...)
+    var stderr bytes.Buffer
+    cmd.Stderr = &stderr
+
+    out, err := cmd.Output()
+    if err != nil {
+        if msg := strings.TrimSpace(stderr.String()); msg != "" {
+            return nil, fmt.Errorf("git %s: %s", args[0], msg)
+        }
+        return nil, fmt.Errorf("git %s: %w", args[0], err)
+    }
+    return out, nil
+}
+
+// TrackedFiles lists the paths recorded in the index.
+func (g *GitRepo) TrackedFiles() ([]string, error) {
+    out, err := g.run("ls-files", "-z", "--cached")
+    if err != nil {
+        return nil, err
+    }
+    return splitNul(out), nil
+}
+
+// FilesAt lists the blobs in the tree of the given revision.
+func (g *GitRepo) FilesAt(ref string) ([]GitFile, error) {
+    out, err := g.run("ls-tree", "-r", "-l", "-z", ref)
+    if err != nil {
+        return nil, err
+    }
+
+    var files []GitFile
+    for _, record := range splitNul(out) {
+        // <mode> SP <type> SP <object> SP+ <size> TAB <path>
+        meta, path, ok := strings.Cut(record, "\t")
+        if !ok {
+            continue
+        }
+        fields := strings.Fields(meta)
+        if len(fields) != 4 || fields[1] != "blob" {
+            continue
+        }
+        size, err := strconv.ParseInt(fields[3], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("unexpected ls-tree output %q: %w", record, err)
+        }
+        files = append(files, GitFile{Path: path, Size: size})
+    }
+    return files, nil
+}
+
+// Show returns the contents of path as of the given revision. Blobs are read
+// through one git cat-file --batch process shared by all calls, as starting a
+// process per file is slow in large trees.
+func (g *GitRepo) Show(ref, path string) ([]byte, error) {
+    object := ref + ":./" + filepath.ToSlash(path)
+    if strings.ContainsAny(object, "\n") {
+        // Cannot be requested in batch mode
+        return g.run("cat-file", "blob", object)
+    }
+
+    g.batchOnce.Do(func() {
+        g.batch, g.batchErr = newBlobReader(g.dir)
+    })
+    if g.batchErr != nil {
+        return nil, g.batchErr
+    }
+    return g.batch.Read(object)
+}
+
+// blobReader reads objects through a long-running git cat-file --batch. It
+// lives as long as the program.
+type blobReader struct {
+    mu  sync.Mutex
+    in  io.Writer
+    out *bufio.Reader
+}
+
+func newBlobReader(dir string) (*blobReader, error) {
+    cmd := exec.Command("git", "-C", dir, "cat-file", "--batch")
+    in, err := cmd.StdinPipe()
+    if err != nil {
+        return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+    }
+    out, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+    }
+    if err := cmd.Start(); err != nil {
+        return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+    }
+    return &blobReader{in: in, out: bufio.NewReader(out)}, nil
+}
+
+func (b *blobReader) Read(object string) ([]byte, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if _, err := fmt.Fprintln(b.in, object); err != nil {
+        return nil, fmt.Errorf("git cat-file: %w", err)
+    }
+    header, err := b.out.ReadString('\n')
+    if err != nil {
+        return nil, fmt.Errorf("git cat-file: %w", err)
+    }
+
+    // <object> SP <type> SP <size> LF <contents> LF, or <name> SP missing LF
+    fields := strings.Fields(header)
+    if len(fields) == 2 && fields[1] == "missing" {
+        return nil, fmt.Errorf("%s: %w", object, os.ErrNotExist)
+    }
+    if len(fields) != 3 {
+        return nil, fmt.Errorf("git cat-file: %s", strings.TrimSpace(header))
+    }
+    size, err := strconv.ParseInt(fields[2], 10, 64)
+    if err != nil {
+        return nil, fmt.Errorf("unexpected cat-file output %q: %w", header, err)
+    }
+
+    content := make([]byte, size+1)
+    if _, err := io.ReadFull(b.out, content); err != nil {
+        return nil, fmt.Errorf("git cat-file: %w", err)
+    }
+    if fields[1] != "blob" {
+        return nil, fmt.Errorf("%s is a %s, not a file", object, fields[1])
+    }
+    return content[:size], nil
+}
+
+// ChangedFiles lists files that differ for the given git diff arguments,
+// excluding deletions since there is no content left to show for them.
+func (g *GitRepo) ChangedFiles(diffArgs ...string) ([]string, error) {
+    args := append([]string{"diff", "--name-only", "-z", "--relative", "--diff-filter=d"}, diffArgs...)
+    out, err := g.run(args...)
+    if err != nil {
+        return nil, err
+    }
+    return splitNul(out), nil
+}
+
+// Diff returns the unified diff of a single file for the given git diff arguments.
+func (g *GitRepo) Diff(path string, diffArgs ...string) (string, error) {
+    args := append([]string{"diff", "--relative", "--no-color"}, diffArgs...)
+    args = append(args, "--", filepath.ToSlash(path))
+    out, err := g.run(args...)
+    if err != nil {
+        return "", err
+    }
+    return string(out), nil
+}
+
+// Log returns a one-line-per-commit summary of the given revision range.
+func (g *GitRepo) Log(revRange string) (string, error) {
+    out, err := g.run("log", "--oneline", "--no-decorate", "--no-color", revRange)
+    if err != nil {
+        return "", err
+    }
+    return string(out), nil
+}
+
+func splitNul(out []byte) []string {
+    var parts []string
+    for _, part := range strings.Split(string(out), "\x00") {
+        if part != "" {
+            parts = append(parts, part)
+        }
+    }
+    return parts
+}
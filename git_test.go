@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newGitRepo creates a repository in a temporary directory, skipping the test
+// when git is not installed.
+func newGitRepo(t *testing.T) string {
+    t.Helper()
+    if _, err := exec.LookPath("git"); err != nil {
+        t.Skip("git not installed")
+    }
+    root := t.TempDir()
+    git(t, root, "init", "-q")
+    return root
+}
+
+// git runs a git command in dir and returns its output.
+func git(t *testing.T, dir string, args ...string) string {
+    t.Helper()
+    args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)
+    cmd := exec.Command("git", args...)
+    cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull)
+    out, err := cmd.CombinedOutput()
+    if err != nil {
+        t.Fatalf("git %s: %v\n%s", strings.Join(args[7:], " "), err, out)
+    }
+    return string(out)
+}
+
+// commit writes files into the repository at root and commits everything.
+func commit(t *testing.T, root string, files map[string]string) {
+    t.Helper()
+    writeFiles(t, root, files)
+    git(t, root, "add", "-A")
+    git(t, root, "commit", "-q", "-m", "update")
+}
+
+func TestOpenGitRepo(t *testing.T) {
+    root := newGitRepo(t)
+    if _, err := OpenGitRepo(root); err != nil {
+        t.Errorf("OpenGitRepo on a repository: %v", err)
+    }
+    if _, err := OpenGitRepo(t.TempDir()); err == nil || !strings.Contains(err.Error(), "not inside a git repository") {
+        t.Errorf("OpenGitRepo outside a repository: got %v", err)
+    }
+}
+
+func TestGitRepoListsFilesRelativeToDir(t *testing.T) {
+    root := newGitRepo(t)
+    commit(t, root, map[string]string{
+        "top.txt":            "top\n",
+        "sub/a.txt":          "aaa\n",
+        "sub/deep/b.txt":     "bb\n",
+        "sub/with space.txt": "x\n",
+        "sub/ünïcode.txt":    "u\n",
+    })
+    writeFiles(t, root, map[string]string{"sub/untracked.txt": "new\n"})
+
+    repo, err := OpenGitRepo(filepath.Join(root, "sub"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := []string{"a.txt", "deep/b.txt", "with space.txt", "ünïcode.txt"}
+    tracked, err := repo.TrackedFiles()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(tracked, want) {
+        t.Errorf("TrackedFiles() = %q, want %q", tracked, want)
+    }
+
+    files, err := repo.FilesAt("HEAD")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wantFiles := []GitFile{{"a.txt", 4}, {"deep/b.txt", 3}, {"with space.txt", 2}, {"ünïcode.txt", 2}}
+    if !reflect.DeepEqual(files, wantFiles) {
+        t.Errorf("FilesAt(HEAD) = %+v, want %+v", files, wantFiles)
+    }
+
+    if _, err := repo.FilesAt("no-such-ref"); err == nil {
+        t.Error("FilesAt on an unknown ref succeeded")
+    }
+}
+
+func TestGitRepoShow(t *testing.T) {
+    root := newGitRepo(t)
+    commit(t, root, map[string]string{"sub/a.txt": "one\n", "sub/empty.txt": "", "sub/bin": "\x00\x01\n\n"})
+    commit(t, root, map[string]string{"sub/a.txt": "two\n"})
+
+    repo, err := OpenGitRepo(filepath.Join(root, "sub"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        ref, path string
+        want      string
+        err       string
+    }{
+        {"HEAD", "a.txt", "two\n", ""},
+        {"HEAD~1", "a.txt", "one\n", ""},
+        {"HEAD", "empty.txt", "", ""},
+        {"HEAD", "bin", "\x00\x01\n\n", ""},
+        {"HEAD", "gone.txt", "", "file does not exist"},
+        {"HEAD", ".", "", "is a tree, not a file"},
+        // The reader stays in step after errors
+        {"HEAD", "a.txt", "two\n", ""},
+    }
+
+    for _, tt := range tests {
+        got, err := repo.Show(tt.ref, tt.path)
+        switch {
+        case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+            t.Errorf("Show(%s, %s) error = %v, want %q", tt.ref, tt.path, err, tt.err)
+        case tt.err == "" && err != nil:
+            t.Errorf("Show(%s, %s) failed: %v", tt.ref, tt.path, err)
+        case string(got) != tt.want:
+            t.Errorf("Show(%s, %s) = %q, want %q", tt.ref, tt.path, got, tt.want)
+        }
+    }
+
+    if _, err := repo.Show("HEAD", "gone.txt"); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("missing file error %v does not wrap os.ErrNotExist", err)
+    }
+
+    // Concurrent readers share the one cat-file process
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func(ref, want string) {
+            defer wg.Done()
+            if got, err := repo.Show(ref, "a.txt"); err != nil || string(got) != want {
+                t.Errorf("Show(%s, a.txt) = %q, %v; want %q", ref, got, err, want)
+            }
+        }([]string{"HEAD", "HEAD~1"}[i%2], []string{"two\n", "one\n"}[i%2])
+    }
+    wg.Wait()
+}
+
+func TestAnalyzerGitRefInSubdirectory(t *testing.T) {
+    root := newGitRepo(t)
+    commit(t, root, map[string]string{"top.txt": "top\n", "sub/a.txt": "old\n", "sub/b.txt": "b\n"})
+    commit(t, root, map[string]string{"sub/a.txt": "new\n", "sub/c.txt": "c\n"})
+    writeFiles(t, root, map[string]string{"sub/a.txt": "working tree\n"})
+
+    path := filepath.Join(root, "sub")
+    repo, err := OpenGitRepo(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := &Config{Path: path, GitTracked: true, GitRef: "HEAD~1", MaxSize: 1 << 20, MaxDepth: 20}
+    a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude), git: repo}
+
+    files, err := a.CollectFiles()
+    if err != nil {
+        t.Fatal(err)
+    }
+    got := make(map[string]string)
+    for _, file := range files {
+        got[filepath.ToSlash(file.Path)] = file.Content
+    }
+    if want := map[string]string{"a.txt": "old\n", "b.txt": "b\n"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("collected %q, want %q", got, want)
+    }
+}
+
+// changesRepo builds a repository with a commit tagged base and, on top of
+// it, a commit that modifies, renames, deletes and adds files, a staged
+// change and an unstaged one.
+func changesRepo(t *testing.T) string {
+    t.Helper()
+    root := newGitRepo(t)
+    commit(t, root, map[string]string{
+        "a.txt":     "first\n",
+        "b.txt":     "b\n",
+        "old.txt":   "one\ntwo\nthree\nfour\nfive\n",
+        "del.txt":   "bye\n",
+        "same.txt":  "unchanged\n",
+        "sub/s.txt": "s\n",
+    })
+    git(t, root, "tag", "base")
+
+    git(t, root, "mv", "old.txt", "new.txt")
+    git(t, root, "rm", "-q", "del.txt")
+    commit(t, root, map[string]string{"a.txt": "second\n", "c.txt": "c\n", "sub/s.txt": "s2\n"})
+
+    writeFiles(t, root, map[string]string{"b.txt": "b staged\n"})
+    git(t, root, "add", "b.txt")
+    writeFiles(t, root, map[string]string{"a.txt": "third\n"})
+    return root
+}
+
+func changesAnalyzer(t *testing.T, path string, configure func(cfg *Config)) *Analyzer {
+    t.Helper()
+    repo, err := OpenGitRepo(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := &Config{Path: path, MaxSize: 1 << 20, MaxDepth: 20, DiffContext: 3}
+    configure(cfg)
+    return &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude), git: repo}
+}
+
+func TestChangedFileSelection(t *testing.T) {
+    root := changesRepo(t)
+
+    tests := []struct {
+        name      string
+        dir       string
+        configure func(cfg *Config)
+        want      []string
+    }{
+        {"changed since", "", func(cfg *Config) { cfg.ChangedSince = "base" },
+            []string{"a.txt", "b.txt", "c.txt", "new.txt", "sub/s.txt"}},
+        {"changed since at a ref", "", func(cfg *Config) { cfg.ChangedSince, cfg.GitRef, cfg.GitTracked = "base", "HEAD", true },
+            []string{"a.txt", "c.txt", "new.txt", "sub/s.txt"}},
+        {"staged", "", func(cfg *Config) { cfg.Staged = true }, []string{"b.txt"}},
+        {"unstaged", "", func(cfg *Config) { cfg.Unstaged = true }, []string{"a.txt"}},
+        {"staged and unstaged", "", func(cfg *Config) { cfg.Staged, cfg.Unstaged = true, true }, []string{"a.txt", "b.txt"}},
+        {"subdirectory", "sub", func(cfg *Config) { cfg.ChangedSince = "base" }, []string{"s.txt"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            a := changesAnalyzer(t, filepath.Join(root, tt.dir), tt.configure)
+            files, err := a.ListFiles()
+            if err != nil {
+                t.Fatal(err)
+            }
+            var got []string
+            for _, file := range files {
+                got = append(got, filepath.ToSlash(file.Path))
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("listed %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestChangedFileDiffs(t *testing.T) {
+    root := changesRepo(t)
+
+    tests := []struct {
+        name      string
+        path      string
+        configure func(cfg *Config)
+        diff      []string
+        content   string
+    }{
+        {"unstaged", "a.txt", func(cfg *Config) { cfg.Unstaged, cfg.WithDiff = true, true },
+            []string{"--- a/a.txt", "-second", "+third"}, "third\n"},
+        {"staged", "b.txt", func(cfg *Config) { cfg.Staged, cfg.WithDiff = true, true },
+            []string{"-b\n", "+b staged"}, "b staged\n"},
+        {"changed since", "a.txt", func(cfg *Config) { cfg.ChangedSince, cfg.WithDiff = "base", true },
+            []string{"-first", "+third"}, "third\n"},
+        {"renamed file", "new.txt", func(cfg *Config) { cfg.ChangedSince, cfg.WithDiff = "base", true },
+            []string{"+++ b/new.txt", "+five"}, "one\ntwo\nthree\nfour\nfive\n"},
+        {"diff only", "c.txt", func(cfg *Config) { cfg.ChangedSince, cfg.DiffOnly = "base", true },
+            []string{"new file mode", "+c"}, ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            a := changesAnalyzer(t, root, tt.configure)
+            entry, err := a.processFile(filepath.Join(root, tt.path))
+            if err != nil {
+                t.Fatal(err)
+            }
+            for _, want := range tt.diff {
+                if !strings.Contains(entry.Diff, want) {
+                    t.Errorf("diff does not contain %q:\n%s", want, entry.Diff)
+                }
+            }
+            if entry.Content != tt.content {
+                t.Errorf("content %q, want %q", entry.Content, tt.content)
+            }
+        })
+    }
+
+    // Deleted files have nothing left to show, so they are not listed
+    a := changesAnalyzer(t, root, func(cfg *Config) { cfg.ChangedSince = "base" })
+    changed, err := a.git.ChangedFiles("base")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, path := range changed {
+        if path == "del.txt" || path == "old.txt" {
+            t.Errorf("ChangedFiles lists %s, which no longer exists", path)
+        }
+    }
+}
+
+func TestChangesHeader(t *testing.T) {
+    root := changesRepo(t)
+    head := strings.TrimSpace(git(t, root, "log", "-1", "--format=%h %s"))
+
+    a := changesAnalyzer(t, root, func(cfg *Config) { cfg.ChangedSince = "base" })
+    header, err := a.Header()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := "Changes in base..HEAD (1 commits):\n" + head + "\n"; header != want {
+        t.Errorf("header %q, want %q", header, want)
+    }
+
+    a = changesAnalyzer(t, root, func(cfg *Config) { cfg.Staged = true })
+    if header, err := a.Header(); err != nil || header != "" {
+        t.Errorf("header without --changed-since = %q, %v; want none", header, err)
+    }
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+var keywords = map[string][]string{
+    "Go": {"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough",
+        "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return",
+        "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+    "Python": {"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del",
+        "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is",
+        "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield",
+        "None", "True", "False"},
+    "JavaScript": {"async", "await", "break", "case", "catch", "class", "const", "continue", "default",
+        "delete", "do", "else", "export", "extends", "finally", "for", "from", "function", "if",
+        "import", "in", "instanceof", "let", "new", "of", "return", "static", "super", "switch",
+        "this", "throw", "try", "typeof", "var", "void", "while", "yield", "null", "undefined",
+        "true", "false"},
+    "Java": {"abstract", "break", "case", "catch", "class", "continue", "default", "do", "else",
+        "enum", "extends", "final", "finally", "for", "if", "implements", "import", "instanceof",
+        "interface", "new", "package", "private", "protected", "public", "return", "static",
+        "super", "switch", "this", "throw", "throws", "try", "void", "while", "null", "true", "false"},
+    "Rust": {"as", "async", "await", "break", "const", "continue", "crate", "else", "enum", "fn",
+        "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref",
+        "return", "self", "Self", "static", "struct", "trait", "type", "unsafe", "use", "where",
+        "while", "true", "false"},
+    "C": {"break", "case", "const", "continue", "default", "do", "else", "enum", "extern", "for",
+        "goto", "if", "return", "sizeof", "static", "struct", "switch", "typedef", "union",
+        "volatile", "while", "#include", "#define", "#ifdef", "#ifndef", "#endif"},
+    "Shell": {"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if",
+        "in", "local", "return", "then", "until", "while"},
+    "Ruby": {"begin", "class", "def", "do", "else", "elsif", "end", "ensure", "if", "module", "nil",
+        "rescue", "return", "self", "unless", "until", "when", "while", "yield", "true", "false"},
+}
+
+func init() {
+    keywords["TypeScript"] = append(keywords["JavaScript"], "enum", "implements", "interface",
+        "namespace", "private", "protected", "public", "readonly", "type")
+    keywords["C++"] = append(keywords["C"], "class", "namespace", "new", "delete", "private",
+        "protected", "public", "template", "this", "throw", "try", "catch", "using", "virtual")
+}
+
+// highlightCode marks up source with tview color tags for comments, string
+// literals and keywords. It reuses the lexer rules of the comment reducers, so
+// it is only as accurate as they are. Unknown languages are returned escaped.
+func highlightCode(content, language string, theme Theme) string {
+    syntax, ok := commentSyntaxes[language]
+    if !ok {
+        return tview.Escape(content)
+    }
+
+    words := make(map[string]bool)
+    for _, word := range keywords[language] {
+        words[word] = true
+    }
+
+    var out, plain strings.Builder
+    flush := func() {
+        out.WriteString(tview.Escape(plain.String()))
+        plain.Reset()
+    }
+    colored := func(color, text string) {
+        flush()
+        out.WriteString("[" + color + "]")
+        out.WriteString(tview.Escape(text))
+        out.WriteString("[-]")
+    }
+
+    for i := 0; i < len(content); {
+        c := content[i]
+        switch {
+        case syntax.blockStart != "" && strings.HasPrefix(content[i:], syntax.blockStart):
+            end := strings.Index(content[i+len(syntax.blockStart):], syntax.blockEnd)
+            if end < 0 {
+                end = len(content)
+            } else {
+                end = i + len(syntax.blockStart) + end + len(syntax.blockEnd)
+            }
+            colored(theme["comment"], content[i:end])
+            i = end
+
+        case isLineComment(content, i, syntax):
+            end := strings.IndexByte(content[i:], '\n')
+            if end < 0 {
+                end = len(content)
+            } else {
+                end += i
+            }
+            colored(theme["comment"], content[i:end])
+            i = end
+
+        case isLiteralStart(content, i, syntax):
+            end := skipLiteral(content, i, syntax)
+            colored(theme["string"], content[i:end])
+            i = end
+
+        case isWordByte(c) || c == '#':
+            end := i + 1
+            for end < len(content) && isWordByte(content[end]) {
+                end++
+            }
+            if words[content[i:end]] {
+                colored(theme["keyword"], content[i:end])
+            } else {
+                plain.WriteString(content[i:end])
+            }
+            i = end
+
+        default:
+            plain.WriteByte(c)
+            i++
+        }
+    }
+    flush()
+
+    return out.String()
+}
+
+func isWordByte(c byte) bool {
+    return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pickerActions lists what can be bound to keys in the picker, in the order
+// the help text shows them.
+var pickerActions = []struct {
+    name        string
+    description string
+}{
+    {"up", "Move up"},
+    {"down", "Move down"},
+    {"top", "First file"},
+    {"bottom", "Last file"},
+    {"collapse", "Collapse directory"},
+    {"expand", "Expand directory"},
+    {"toggle", "Select file or directory"},
+    {"select-all", "Select all matching"},
+    {"invert", "Invert matching"},
+    {"clear", "Clear selection"},
+    {"sort", "Cycle sort order"},
+    {"selected-only", "Show selected only"},
+    {"preview-down", "Scroll preview down"},
+    {"preview-up", "Scroll preview up"},
+    {"search", "Focus search"},
+    {"switch-focus", "Search/tree focus"},
+    {"help", "Show/hide key bindings"},
+    {"save", "Save selection set"},
+    {"load", "Load selection set"},
+    {"confirm", "Confirm selection"},
+    {"cancel", "Cancel"},
+}
+
+var defaultKeys = map[string][]string{
+    "up":            {"Up"},
+    "down":          {"Down"},
+    "top":           {"Home"},
+    "bottom":        {"End"},
+    "collapse":      {"Left"},
+    "expand":        {"Right"},
+    "toggle":        {"Space"},
+    "select-all":    {"a"},
+    "invert":        {"i"},
+    "clear":         {"c"},
+    "sort":          {"s"},
+    "selected-only": {"v"},
+    "preview-down":  {"PgDn"},
+    "preview-up":    {"PgUp"},
+    "search":        {"/"},
+    "switch-focus":  {"Tab"},
+    "help":          {"?"},
+    "save":          {"Ctrl-S"},
+    "load":          {"Ctrl-O"},
+    "confirm":       {"Enter"},
+    "cancel":        {"Esc"},
+}
+
+// keyPresets add to the default keys rather than replacing them, so arrow
+// keys keep working.
+var keyPresets = map[string]map[string][]string{
+    "default": {},
+    "vim": {
+        "up":           {"k"},
+        "down":         {"j"},
+        "top":          {"gg"},
+        "bottom":       {"G"},
+        "collapse":     {"h"},
+        "expand":       {"l"},
+        "preview-down": {"Ctrl-D"},
+        "preview-up":   {"Ctrl-U"},
+    },
+}
+
+// Keymap maps key sequences to picker actions. A sequence is one or more key
+// names: tcell names such as "Ctrl-S", "PgDn" or "Space", or single
+// characters. A binding like "gg" that is not a key name is a sequence of
+// characters.
+type Keymap struct {
+    keys     map[string][]string
+    bindings map[string]string
+    pending  []string
+}
+
+func NewKeymap(preset string, overrides map[string][]string) (*Keymap, error) {
+    if preset == "" {
+        preset = "default"
+    }
+    extra, ok := keyPresets[preset]
+    if !ok {
+        return nil, fmt.Errorf("unknown keymap preset: %s", preset)
+    }
+
+    km := &Keymap{keys: make(map[string][]string), bindings: make(map[string]string)}
+    for action, keys := range defaultKeys {
+        km.keys[action] = append(km.keys[action], keys...)
+    }
+    for action, keys := range extra {
+        km.keys[action] = append(km.keys[action], keys...)
+    }
+    for action, keys := range overrides {
+        if _, ok := defaultKeys[action]; !ok {
+            return nil, fmt.Errorf("unknown picker action in keys: %s", action)
+        }
+        km.keys[action] = keys
+    }
+
+    for action, keys := range km.keys {
+        for _, key := range keys {
+            seq, err := parseKeySequence(key)
+            if err != nil {
+                return nil, err
+            }
+            id := strings.Join(seq, " ")
+            if other, ok := km.bindings[id]; ok && other != action {
+                return nil, fmt.Errorf("key %s is bound to both %s and %s", key, other, action)
+            }
+            km.bindings[id] = action
+        }
+    }
+    return km, nil
+}
+
+var keysByName = func() map[string]bool {
+    names := map[string]bool{"Space": true}
+    for _, name := range tcell.KeyNames {
+        names[name] = true
+    }
+    return names
+}()
+
+func parseKeySequence(key string) ([]string, error) {
+    if key == " " {
+        return []string{"Space"}, nil
+    }
+    if keysByName[key] || len([]rune(key)) == 1 {
+        return []string{key}, nil
+    }
+    if key == "" || strings.ContainsAny(key, " -+") {
+        return nil, fmt.Errorf("unknown key: %s", key)
+    }
+    var seq []string
+    for _, r := range key {
+        seq = append(seq, string(r))
+    }
+    return seq, nil
+}
+
+func keyName(event *tcell.EventKey) string {
+    if event.Key() == tcell.KeyRune {
+        if event.Rune() == ' ' {
+            return "Space"
+        }
+        return string(event.Rune())
+    }
+    if name, ok := tcell.KeyNames[event.Key()]; ok {
+        return name
+    }
+    return fmt.Sprintf("Key[%d]", event.Key())
+}
+
+// Action returns the action for event, taking keys pressed before it into
+// account. It returns "" when the key starts a longer sequence or is not
+// bound; handled reports which of the two it was.
+func (km *Keymap) Action(event *tcell.EventKey) (action string, handled bool) {
+    seq := append(append([]string(nil), km.pending...), keyName(event))
+    id := strings.Join(seq, " ")
+    if action, ok := km.bindings[id]; ok {
+        km.pending = nil
+        return action, true
+    }
+    for binding := range km.bindings {
+        if strings.HasPrefix(binding, id+" ") {
+            km.pending = seq
+            return "", true
+        }
+    }
+
+    // A broken-off sequence is dropped, but its last key may stand alone
+    hadPending := len(km.pending) > 0
+    km.pending = nil
+    if hadPending {
+        return km.Action(event)
+    }
+    return "", false
+}
+
+// Lookup returns the action bound to a single key, ignoring sequences.
+func (km *Keymap) Lookup(key string) string {
+    return km.bindings[key]
+}
+
+// Help renders the active bindings in two columns.
+func (km *Keymap) Help() string {
+    var entries []string
+    width := 0
+    for _, a := range pickerActions {
+        keys := km.keys[a.name]
+        if len(keys) == 0 {
+            continue
+        }
+        entry := fmt.Sprintf("%-12s %s", strings.Join(keys, "/"), a.description)
+        entries = append(entries, entry)
+        width = max(width, len([]rune(entry)))
+    }
+
+    var lines []string
+    half := (len(entries) + 1) / 2
+    for i := 0; i < half; i++ {
+        line := entries[i]
+        if i+half < len(entries) {
+            line += strings.Repeat(" ", width+3-len([]rune(line))) + entries[i+half]
+        }
+        lines = append(lines, line)
+    }
+    return strings.Join(lines, "\n")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+var languagesByExt = map[string]string{
+    ".go":      "Go",
+    ".py":      "Python",
+    ".pyi":     "Python",
+    ".js":      "JavaScript",
+    ".mjs":     "JavaScript",
+    ".cjs":     "JavaScript",
+    ".jsx":     "JavaScript",
+    ".ts":      "TypeScript",
+    ".mts":     "TypeScript",
+    ".cts":     "TypeScript",
+    ".tsx":     "TypeScript",
+    ".java":    "Java",
+    ".kt":      "Kotlin",
+    ".kts":     "Kotlin",
+    ".scala":   "Scala",
+    ".rs":      "Rust",
+    ".c":       "C",
+    ".h":       "C",
+    ".cc":      "C++",
+    ".cpp":     "C++",
+    ".cxx":     "C++",
+    ".hh":      "C++",
+    ".hpp":     "C++",
+    ".hxx":     "C++",
+    ".cs":      "C#",
+    ".m":       "Objective-C",
+    ".mm":      "Objective-C",
+    ".swift":   "Swift",
+    ".rb":      "Ruby",
+    ".php":     "PHP",
+    ".pl":      "Perl",
+    ".pm":      "Perl",
+    ".lua":     "Lua",
+    ".r":       "R",
+    ".dart":    "Dart",
+    ".ex":      "Elixir",
+    ".exs":     "Elixir",
+    ".erl":     "Erlang",
+    ".hs":      "Haskell",
+    ".ml":      "OCaml",
+    ".clj":     "Clojure",
+    ".zig":     "Zig",
+    ".sh":      "Shell",
+    ".bash":    "Shell",
+    ".zsh":     "Shell",
+    ".fish":    "Shell",
+    ".ps1":     "PowerShell",
+    ".sql":     "SQL",
+    ".html":    "HTML",
+    ".htm":     "HTML",
+    ".css":     "CSS",
+    ".scss":    "SCSS",
+    ".sass":    "SCSS",
+    ".less":    "Less",
+    ".vue":     "Vue",
+    ".svelte":  "Svelte",
+    ".json":    "JSON",
+    ".yaml":    "YAML",
+    ".yml":     "YAML",
+    ".toml":    "TOML",
+    ".xml":     "XML",
+    ".md":      "Markdown",
+    ".rst":     "reStructuredText",
+    ".proto":   "Protocol Buffers",
+    ".graphql": "GraphQL",
+    ".tf":      "Terraform",
+    ".mk":      "Makefile",
+    ".cmake":   "CMake",
+    ".txt":     "Text",
+}
+
+var languagesByName = map[string]string{
+    "Makefile":       "Makefile",
+    "makefile":       "Makefile",
+    "GNUmakefile":    "Makefile",
+    "Dockerfile":     "Dockerfile",
+    "Containerfile":  "Dockerfile",
+    "CMakeLists.txt": "CMake",
+    "Rakefile":       "Ruby",
+    "Gemfile":        "Ruby",
+    "Jenkinsfile":    "Groovy",
+    "Vagrantfile":    "Ruby",
+    "BUILD":          "Starlark",
+    "BUILD.bazel":    "Starlark",
+    "WORKSPACE":      "Starlark",
+    "go.mod":         "Go Module",
+    "go.work":        "Go Module",
+}
+
+var languagesByInterpreter = map[string]string{
+    "sh":      "Shell",
+    "bash":    "Shell",
+    "zsh":     "Shell",
+    "dash":    "Shell",
+    "ksh":     "Shell",
+    "fish":    "Shell",
+    "python":  "Python",
+    "python2": "Python",
+    "python3": "Python",
+    "node":    "JavaScript",
+    "deno":    "TypeScript",
+    "ts-node": "TypeScript",
+    "ruby":    "Ruby",
+    "perl":    "Perl",
+    "php":     "PHP",
+    "lua":     "Lua",
+    "Rscript": "R",
+    "pwsh":    "PowerShell",
+}
+
+// languageAliases maps the short names accepted by --lang onto language names.
+var languageAliases = map[string]string{
+    "golang": "go",
+    "py":     "python",
+    "js":     "javascript",
+    "ts":     "typescript",
+    "rs":     "rust",
+    "cpp":    "c++",
+    "cxx":    "c++",
+    "csharp": "c#",
+    "rb":     "ruby",
+    "sh":     "shell",
+    "bash":   "shell",
+    "yml":    "yaml",
+    "md":     "markdown",
+    "docker": "dockerfile",
+    "make":   "makefile",
+}
+
+// languageFromPath detects a language from the file name alone, returning ""
+// if the name is not conclusive.
+func languageFromPath(path string) string {
+    base := filepath.Base(path)
+    if lang, ok := languagesByName[base]; ok {
+        return lang
+    }
+    if strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+        return "Dockerfile"
+    }
+    return languagesByExt[strings.ToLower(filepath.Ext(base))]
+}
+
+// detectLanguage detects a language from the file name, falling back to the
+// interpreter named in a shebang line.
+func detectLanguage(path, content string) string {
+    if lang := languageFromPath(path); lang != "" {
+        return lang
+    }
+
+    if !strings.HasPrefix(content, "#!") {
+        return ""
+    }
+    line, _, _ := strings.Cut(content, "\n")
+    fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+    if len(fields) == 0 {
+        return ""
+    }
+
+    interpreter := filepath.Base(fields[0])
+    if interpreter == "env" {
+        // #!/usr/bin/env [-S] python3
+        interpreter = ""
+        for _, field := range fields[1:] {
+            if !strings.HasPrefix(field, "-") {
+                interpreter = field
+                break
+            }
+        }
+    }
+    return languagesByInterpreter[interpreter]
+}
+
+// normalizeLanguage turns a language name or alias into the lowercase form
+// used to compare against --lang.
+func normalizeLanguage(name string) string {
+    name = strings.ToLower(strings.TrimSpace(name))
+    if alias, ok := languageAliases[name]; ok {
+        return alias
+    }
+    return name
+}
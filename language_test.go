@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLanguageFilter(t *testing.T) {
+    tests := []struct {
+        name   string
+        langs  []string
+        path   string
+        reason string
+    }{
+        {"no filter", nil, "notes.xyz", ""},
+        {"wanted language", []string{"go"}, "main.go", ""},
+        {"alias", []string{"golang", "py"}, "tool.py", ""},
+        {"case and spaces", []string{" Go "}, "main.go", ""},
+        {"other language", []string{"go"}, "tool.py", "Python"},
+        {"unknown language", []string{"go"}, "notes.xyz", "unknown language"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := &Config{Path: "/repo"}
+            for _, lang := range tt.langs {
+                cfg.Languages = append(cfg.Languages, normalizeLanguage(lang))
+            }
+            a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude)}
+
+            _, err := a.createFileEntry("/repo/"+tt.path, []byte("x\n"), 2)
+            var skip *SkipError
+            switch {
+            case tt.reason == "" && err != nil:
+                t.Errorf("skipped %s: %v", tt.path, err)
+            case tt.reason != "" && !errors.As(err, &skip):
+                t.Errorf("kept %s (error %v), want it skipped", tt.path, err)
+            case tt.reason != "" && (skip.Kind != "other-language" || skip.Reason != tt.reason):
+                t.Errorf("skipped %s as %v, want other-language (%s)", tt.path, skip, tt.reason)
+            }
+        })
+    }
+}
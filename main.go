@@ -5,27 +5,54 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
-	"time"
 )
 
 func parseFlags() (*Config, error) {
     cfg := &Config{}
 	cfg.TokenizerType = TiktokenGPT35
     flag.StringVar(&cfg.Path, "path", ".", "Directory to analyze")
-    includeStr := flag.String("include", "", "Patterns to include (comma-separated)")
+    includeStr := flag.String("include", "", "Patterns to include (comma-separated); path:start-end selects a line range")
     excludeStr := flag.String("exclude", "", "Patterns to exclude (comma-separated)")
+    transformStr := flag.String("transform", "", "Content transforms to apply before tokenizing (comma-separated: trim-trailing, collapse-blank, tabs-to-spaces, strip-comments, strip-license, strip-docstrings, drop-imports)")
+    fullStr := flag.String("full", "", "Patterns of files to keep in full when using --outline (comma-separated)")
+    langStr := flag.String("lang", "", "Only include these languages (comma-separated, e.g. go,python)")
     flag.Int64Var(&cfg.MaxSize, "max-size", 10*1024*1024, "Maximum file size in bytes")
     flag.IntVar(&cfg.MaxDepth, "max-depth", 20, "Maximum directory depth")
-    flag.StringVar(&cfg.Output, "output", "both", "Output format (tree, files, or both)")
-    flag.IntVar(&cfg.Threads, "threads", 0, "Number of threads for parallel processing")
+    flag.StringVar(&cfg.Output, "output", "both", "Output format (tree, files, both, or diff)")
+    flag.BoolVar(&cfg.TreeTokens, "tree-tokens", false, "Annotate the tree with token counts per file and directory")
+    flag.IntVar(&cfg.TreeDepth, "tree-depth", 0, "Collapse tree directories below this depth (0 shows all levels)")
+    flag.Float64Var(&cfg.TreeHighlight, "tree-highlight", 10, "Highlight tree nodes using more than this percentage of the token limit")
+    flag.IntVar(&cfg.Threads, "threads", 0, "Number of threads for parallel processing (default: number of CPUs)")
+    flag.BoolVar(&cfg.Outline, "outline", false, "Reduce source files to declarations and signatures, eliding function bodies (Go, Python, JavaScript, TypeScript, Java, Rust)")
+    flag.BoolVar(&cfg.LineNumbers, "line-numbers", false, "Prefix file content lines with their line numbers")
+    flag.StringVar(&cfg.Secrets, "secrets", "redact", "How to handle detected credentials (redact, fail, or off)")
+    flag.BoolVar(&cfg.AllowSensitive, "allow-sensitive", false, "Include files that commonly hold credentials (.env, *.pem, id_rsa, ...)")
     flag.BoolVar(&cfg.Hidden, "hidden", false, "Show hidden files and directories")
+    flag.StringVar(&cfg.Generated, "generated", "exclude", "How to handle generated files, lockfiles and minified code (exclude, mark, or include)")
+    flag.BoolVar(&cfg.Verbose, "verbose", false, "List every skipped file and the reason it was skipped")
     flag.BoolVar(&cfg.UseClip, "c", false, "Copy output to clipboard")
     flag.BoolVar(&cfg.Interactive, "i", false, "Interactive mode")
+    flag.BoolVar(&cfg.Watch, "watch", false, "Re-emit output whenever files change")
+    keymapStr := flag.String("keymap", "", "Picker key bindings: default or vim (overrides the config file)")
+    themeStr := flag.String("theme", "", "Picker colors: dark or light (overrides the config file)")
     
     tokenizerType := flag.String("tokenizer", "", "Tokenizer type (gpt-3.5-turbo, gpt-4, claude, huggingface)")
     flag.StringVar(&cfg.TokenizerModel, "tokenizer-model", "", "Path to HuggingFace tokenizer model")
     flag.IntVar(&cfg.TokenLimit, "token-limit", 4096, "Maximum token limit")
+    flag.StringVar(&cfg.Selection, "selection", "", "Use the files of a saved selection set from .peeker/selections")
+    flag.BoolVar(&cfg.StrictBudget, "strict-budget", false, "In interactive mode, refuse selections that exceed --token-limit")
+    flag.BoolVar(&cfg.GitTracked, "git-tracked", false, "Only include files tracked by git")
+    flag.StringVar(&cfg.GitRef, "git-ref", "", "Read tracked files from this git revision instead of the working tree (implies --git-tracked)")
+    flag.StringVar(&cfg.ChangedSince, "changed-since", "", "Only include files changed since this git revision")
+    flag.BoolVar(&cfg.Staged, "staged", false, "Only include files with staged changes")
+    flag.BoolVar(&cfg.Unstaged, "unstaged", false, "Only include files with unstaged changes")
+    flag.BoolVar(&cfg.WithDiff, "with-diff", false, "Include each file's diff alongside its content")
+    flag.BoolVar(&cfg.DiffOnly, "diff-only", false, "Include each file's diff instead of its content")
+    flag.IntVar(&cfg.DiffContext, "context", 3, "Lines of context around each diff hunk")
+    flag.BoolVar(&cfg.FuncContext, "function-context", false, "Expand diff hunks to the whole enclosing function")
 
     flag.Parse()
 
@@ -33,13 +60,105 @@ func parseFlags() (*Config, error) {
         return nil, fmt.Errorf("path '%s' does not exist", cfg.Path)
     }
 
+    if cfg.GitRef != "" {
+        cfg.GitTracked = true
+    }
+
+    switch cfg.Generated {
+    case "exclude", "mark", "include":
+    default:
+        return nil, fmt.Errorf("invalid --generated mode: %s", cfg.Generated)
+    }
+
+    switch cfg.Secrets {
+    case "redact", "fail", "off":
+    default:
+        return nil, fmt.Errorf("invalid --secrets mode: %s", cfg.Secrets)
+    }
+
+    if cfg.Interactive {
+        fileCfg, err := LoadFileConfig(cfg.Path)
+        if err != nil {
+            return nil, err
+        }
+        if *keymapStr != "" {
+            fileCfg.Keymap = *keymapStr
+        }
+        if *themeStr != "" {
+            fileCfg.Theme = *themeStr
+        }
+
+        if cfg.Keymap, err = NewKeymap(fileCfg.Keymap, fileCfg.Keys); err != nil {
+            return nil, fmt.Errorf("invalid key bindings: %w", err)
+        }
+        if cfg.Theme, err = NewTheme(fileCfg.Theme, fileCfg.Colors); err != nil {
+            return nil, fmt.Errorf("invalid theme: %w", err)
+        }
+    }
+
+    if cfg.Watch && cfg.Interactive {
+        return nil, fmt.Errorf("--watch cannot be combined with interactive mode")
+    }
+
+    if cfg.Output == "diff" {
+        cfg.DiffOnly = true
+        if cfg.ChangedSince == "" && !cfg.Staged && !cfg.Unstaged {
+            cfg.ChangedSince = "HEAD"
+        }
+    }
+
+    if cfg.DiffContext < 0 {
+        return nil, fmt.Errorf("--context must not be negative")
+    }
+
+    if (cfg.WithDiff || cfg.DiffOnly) && cfg.ChangedSince == "" && !cfg.Staged && !cfg.Unstaged {
+        return nil, fmt.Errorf("--with-diff and --diff-only require --changed-since, --staged or --unstaged")
+    }
+
     if *includeStr != "" {
-        cfg.Include = strings.Split(*includeStr, ",")
+        for _, pattern := range strings.Split(*includeStr, ",") {
+            pattern, lineRange, err := parseLineRange(pattern)
+            if err != nil {
+                return nil, err
+            }
+            if lineRange != nil {
+                cfg.LineRanges = append(cfg.LineRanges, *lineRange)
+            }
+            cfg.Include = append(cfg.Include, pattern)
+        }
     }
     if *excludeStr != "" {
         cfg.Exclude = strings.Split(*excludeStr, ",")
     }
 
+    if *transformStr != "" {
+        cfg.Transforms = strings.Split(*transformStr, ",")
+    }
+
+    if cfg.LineNumbers {
+        if cfg.Outline {
+            return nil, fmt.Errorf("--line-numbers cannot be combined with --outline, which removes lines")
+        }
+        for _, name := range cfg.Transforms {
+            name = strings.TrimSpace(name)
+            if _, ok := transforms[name]; ok && !linePreserving[name] {
+                return nil, fmt.Errorf("--line-numbers cannot be combined with the %s transform, which removes lines", name)
+            }
+        }
+    }
+
+    if *fullStr != "" {
+        cfg.Full = strings.Split(*fullStr, ",")
+    }
+
+    if *langStr != "" {
+        for _, lang := range strings.Split(*langStr, ",") {
+            if lang = normalizeLanguage(lang); lang != "" {
+                cfg.Languages = append(cfg.Languages, lang)
+            }
+        }
+    }
+
     if *tokenizerType != "" {
         switch *tokenizerType {
         case "gpt-3.5-turbo":
@@ -61,6 +180,28 @@ func parseFlags() (*Config, error) {
     return cfg, nil
 }
 
+var lineRangeRe = regexp.MustCompile(`^(.+):(\d+)(?:-(\d+))?$`)
+
+// parseLineRange splits an include pattern of the form path:start-end or
+// path:line into the path pattern and its line range.
+func parseLineRange(pattern string) (string, *LineRange, error) {
+    m := lineRangeRe.FindStringSubmatch(pattern)
+    if m == nil {
+        return pattern, nil, nil
+    }
+
+    start, _ := strconv.Atoi(m[2])
+    end := start
+    if m[3] != "" {
+        end, _ = strconv.Atoi(m[3])
+    }
+    if start < 1 || end < start {
+        return "", nil, fmt.Errorf("invalid line range in '%s'", pattern)
+    }
+
+    return m[1], &LineRange{Pattern: m[1], Start: start, End: end}, nil
+}
+
 func main() {
     cfg, err := parseFlags()
     if err != nil {
@@ -74,76 +215,128 @@ func main() {
         os.Exit(1)
     }
 
-    files, err := analyzer.CollectFiles()
+    var selection []string
+    if cfg.Selection != "" {
+        selection, err = LoadSelection(cfg.Path, cfg.Selection)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+    }
+
+    var files []FileEntry
+    switch {
+    case cfg.Interactive:
+        // The picker reads and tokenizes files in the background, so that it
+        // can open before large repositories have been processed
+        files, err = analyzer.ListFiles()
+    case cfg.Selection != "":
+        var missing []string
+        files, missing, err = analyzer.CollectSelection(selection)
+        if len(missing) > 0 {
+            fmt.Fprintf(os.Stderr, "Warning: %d files in selection '%s' not found: %s\n",
+                len(missing), cfg.Selection, strings.Join(missing, ", "))
+        }
+    default:
+        files, err = analyzer.CollectFiles()
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+
+    header, err := analyzer.Header()
     if err != nil {
         fmt.Fprintf(os.Stderr, "Error: %v\n", err)
         os.Exit(1)
     }
 
     if cfg.Interactive {
-        selectedChan := make(chan []FileEntry, 1)
-        
-        picker := NewFilePicker(files, func(selected []FileEntry) {
-            defer close(selectedChan) 
-            if len(selected) == 0 {
-                selectedChan <- nil
-                return
-            }
-            
-            var processedFiles []FileEntry
-            for _, file := range selected {
-                if file.Content == "" {
-                    entry, err := analyzer.processFile(filepath.Join(cfg.Path, file.Path))
-                    if err != nil {
-                        fmt.Fprintf(os.Stderr, "Error loading file %s: %v\n", file.Path, err)
-                        continue
-                    }
-                    processedFiles = append(processedFiles, entry)
-                } else {
-                    processedFiles = append(processedFiles, file)
-                }
-            }
-            selectedChan <- processedFiles
+        picker := NewFilePicker(files, cfg)
+        picker.SetLoader(func(path string) (FileEntry, error) {
+            return analyzer.processFile(filepath.Join(cfg.Path, path))
         })
-
-        if picker == nil {
-            fmt.Fprintf(os.Stderr, "Error: failed to create file picker\n")
-            os.Exit(1)
+        var notices []string
+        if skipped := analyzer.SensitiveSkipped(); len(skipped) > 0 {
+            notices = append(notices, fmt.Sprintf("%d sensitive files hidden (use --allow-sensitive to include them)", len(skipped)))
         }
-        
-        done := make(chan error, 1)
-        go func() {
-            done <- picker.Run()
-        }()
-
-        select {
-        case err := <-done:
+        picker.SetSplitter(analyzer.SplitUnlisted)
+        if selection != nil {
+            missing, excluded, err := picker.SetSelection(selection)
             if err != nil {
                 fmt.Fprintf(os.Stderr, "Error: %v\n", err)
                 os.Exit(1)
             }
-        case <-time.After(100 * time.Millisecond): 
+            if len(missing) > 0 {
+                notices = append(notices, fmt.Sprintf("%d files in selection '%s' not found: %s",
+                    len(missing), cfg.Selection, strings.Join(missing, ", ")))
+            }
+            if len(excluded) > 0 {
+                notices = append(notices, fmt.Sprintf("%d files in selection '%s' excluded by the current filters: %s",
+                    len(excluded), cfg.Selection, strings.Join(excluded, ", ")))
+            }
         }
+        picker.SetNotice(strings.Join(notices, "; "))
 
-        selectedFiles := <-selectedChan
-        if selectedFiles == nil {
+        selected, confirmed, err := picker.Run()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        if !confirmed {
             fmt.Println("Operation cancelled.")
             os.Exit(0)
         }
 
+        // Files the picker had not loaded yet are read now
+        var selectedFiles []FileEntry
+        for _, file := range selected {
+            if file.TokenCount == nil && file.Content == "" && file.Diff == "" {
+                entry, err := analyzer.processFile(filepath.Join(cfg.Path, file.Path))
+                if err != nil {
+                    fmt.Fprintf(os.Stderr, "Error loading file %s: %v\n", file.Path, err)
+                    continue
+                }
+                file = entry
+            }
+            printWarnings(file)
+            selectedFiles = append(selectedFiles, file)
+        }
+
         if len(selectedFiles) == 0 {
             fmt.Println("No files selected.")
             os.Exit(0)
         }
 
-        if err := generateOutput(selectedFiles, cfg.Output, cfg.UseClip); err != nil {
+        // Counts of files read after the picker closed were never checked
+        if cfg.StrictBudget && cfg.TokenLimit > 0 {
+            tokens := 0
+            for _, file := range selectedFiles {
+                if file.TokenCount != nil {
+                    tokens += file.TokenCount.Count
+                }
+            }
+            if tokens > cfg.TokenLimit {
+                fmt.Fprintf(os.Stderr, "Error: the selection uses %d tokens, over the limit of %d\n", tokens, cfg.TokenLimit)
+                os.Exit(1)
+            }
+        }
+
+        if err := generateOutput(selectedFiles, header, cfg); err != nil {
             fmt.Fprintf(os.Stderr, "Error: %v\n", err)
             os.Exit(1)
         }
     } else {
-        if err := generateOutput(files, cfg.Output, cfg.UseClip); err != nil {
+        if err := generateOutput(files, header, cfg); err != nil {
             fmt.Fprintf(os.Stderr, "Error: %v\n", err)
             os.Exit(1)
         }
+
+        if cfg.Watch {
+            if err := analyzer.Watch(files); err != nil {
+                fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+                os.Exit(1)
+            }
+        }
     }
 }
\ No newline at end of file
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// Outliner reduces source code to its signatures for --outline. Languages
+// without an outliner are passed through in full.
+type Outliner interface {
+    Outline(content string) (string, error)
+}
+
+var outliners = make(map[string]Outliner)
+
+func RegisterOutliner(language string, o Outliner) {
+    outliners[language] = o
+}
+
+func init() {
+    RegisterOutliner("Go", goOutliner{})
+    RegisterOutliner("Python", pythonOutliner{})
+    RegisterOutliner("JavaScript", braceOutliner{syntax: jsComments, isFunction: isJSFunction})
+    RegisterOutliner("TypeScript", braceOutliner{syntax: jsComments, isFunction: isJSFunction})
+    RegisterOutliner("Java", braceOutliner{syntax: cComments, isFunction: isJavaMethod})
+    RegisterOutliner("Rust", braceOutliner{syntax: commentSyntaxes["Rust"], isFunction: isRustFunction})
+}
+
+type goOutliner struct{}
+
+func (goOutliner) Outline(content string) (string, error) {
+    return outlineGo(content)
+}
+
+// outlineGo reduces Go source to its API shape: the package clause, imports,
+// declarations and function signatures with their doc comments. Function
+// bodies and the comments inside them are dropped.
+func outlineGo(content string) (string, error) {
+    fset := token.NewFileSet()
+    file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+    if err != nil {
+        return "", fmt.Errorf("failed to parse Go source: %w", err)
+    }
+
+    var bodies []*ast.BlockStmt
+    for _, decl := range file.Decls {
+        if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+            bodies = append(bodies, fn.Body)
+            fn.Body = nil
+        }
+    }
+
+    var comments []*ast.CommentGroup
+    for _, group := range file.Comments {
+        inBody := false
+        for _, body := range bodies {
+            if group.Pos() > body.Lbrace && group.End() <= body.Rbrace {
+                inBody = true
+                break
+            }
+        }
+        if !inBody {
+            comments = append(comments, group)
+        }
+    }
+    file.Comments = comments
+
+    var buf bytes.Buffer
+    cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+    if err := cfg.Fprint(&buf, fset, file); err != nil {
+        return "", fmt.Errorf("failed to print Go outline: %w", err)
+    }
+    return buf.String(), nil
+}
+
+var (
+    pyDefRe = regexp.MustCompile(`^(\s*)(async\s+def|def)\b`)
+    pyDocRe = regexp.MustCompile(`^\s*[rRuUbB]{0,2}("""|'''|"|')`)
+)
+
+// pythonOutliner keeps classes, decorators, def signatures and docstrings,
+// replacing each function body with "...". Everything else at class or
+// module level is kept, since it is usually short and often meaningful.
+type pythonOutliner struct{}
+
+func (pythonOutliner) Outline(content string) (string, error) {
+    lines := strings.Split(content, "\n")
+    var out []string
+
+    for i := 0; i < len(lines); i++ {
+        m := pyDefRe.FindStringSubmatch(lines[i])
+        if m == nil {
+            out = append(out, lines[i])
+            continue
+        }
+        indent := len(m[1])
+
+        // The signature may span lines until its parentheses close
+        depth := 0
+        for ; i < len(lines); i++ {
+            out = append(out, lines[i])
+            depth += strings.Count(lines[i], "(") + strings.Count(lines[i], "[") -
+                strings.Count(lines[i], ")") - strings.Count(lines[i], "]")
+            if depth <= 0 {
+                break
+            }
+        }
+        if i >= len(lines) {
+            break
+        }
+        code, _, _ := strings.Cut(lines[i], "#")
+        if !strings.HasSuffix(strings.TrimSpace(code), ":") {
+            // One-line body, e.g. "def f(): return 1"
+            continue
+        }
+
+        j := i + 1
+        for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+            j++
+        }
+        bodyIndent := strings.Repeat(" ", indent+4)
+        if j < len(lines) && indentWidth(lines[j]) > indent {
+            bodyIndent = lines[j][:len(lines[j])-len(strings.TrimLeft(lines[j], " \t"))]
+
+            if dm := pyDocRe.FindStringSubmatch(lines[j]); dm != nil {
+                delim := dm[1]
+                out = append(out, lines[j])
+                rest := strings.TrimSpace(lines[j])
+                rest = rest[strings.Index(rest, delim)+len(delim):]
+                if len(delim) == 3 && !strings.Contains(rest, delim) {
+                    for j++; j < len(lines); j++ {
+                        out = append(out, lines[j])
+                        if strings.Contains(lines[j], delim) {
+                            break
+                        }
+                    }
+                }
+                j++
+            }
+        }
+        out = append(out, bodyIndent+"...")
+
+        // Skip the rest of the body, keeping one blank line if it had any.
+        // Comments may sit at any column, so blank and comment lines only
+        // end the body if no more indented code follows them.
+        blank := false
+        for j < len(lines) {
+            if isPyFiller(lines[j]) {
+                k := j
+                for k < len(lines) && isPyFiller(lines[k]) {
+                    k++
+                }
+                if k < len(lines) && indentWidth(lines[k]) > indent {
+                    j = k
+                    continue
+                }
+                for j < k && (strings.TrimSpace(lines[j]) == "" || indentWidth(lines[j]) > indent) {
+                    blank = strings.TrimSpace(lines[j]) == ""
+                    j++
+                }
+                break
+            }
+            if indentWidth(lines[j]) <= indent {
+                break
+            }
+            blank = false
+            j++
+        }
+        if blank {
+            out = append(out, "")
+        }
+        i = j - 1
+    }
+
+    return strings.Join(out, "\n"), nil
+}
+
+// isPyFiller reports whether line holds nothing but whitespace or a comment.
+func isPyFiller(line string) bool {
+    trimmed := strings.TrimSpace(line)
+    return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+func indentWidth(line string) int {
+    width := 0
+    for _, c := range line {
+        switch c {
+        case ' ':
+            width++
+        case '\t':
+            width += 8 - width%8
+        default:
+            return width
+        }
+    }
+    return width
+}
+
+// braceOutliner handles languages that delimit bodies with braces. Each "{"
+// is classified by the text leading up to it: function bodies are replaced
+// with "{ ... }", while classes, interfaces, impls and the like are kept so
+// their members can be outlined in turn.
+type braceOutliner struct {
+    syntax     commentSyntax
+    isFunction func(header string) bool
+}
+
+func (o braceOutliner) Outline(content string) (string, error) {
+    var out, header strings.Builder
+
+    for i := 0; i < len(content); {
+        c := content[i]
+        switch {
+        case o.syntax.blockStart != "" && strings.HasPrefix(content[i:], o.syntax.blockStart):
+            end := strings.Index(content[i+len(o.syntax.blockStart):], o.syntax.blockEnd)
+            if end < 0 {
+                out.WriteString(content[i:])
+                i = len(content)
+            } else {
+                end = i + len(o.syntax.blockStart) + end + len(o.syntax.blockEnd)
+                out.WriteString(content[i:end])
+                i = end
+            }
+
+        case isLineComment(content, i, o.syntax):
+            end := strings.IndexByte(content[i:], '\n')
+            if end < 0 {
+                end = len(content) - i
+            }
+            out.WriteString(content[i : i+end])
+            i += end
+
+        case isLiteralStart(content, i, o.syntax):
+            end := skipLiteral(content, i, o.syntax)
+            out.WriteString(content[i:end])
+            header.WriteString(content[i:end])
+            i = end
+
+        case c == '{':
+            if o.isFunction(normalizeHeader(header.String())) {
+                out.WriteString("{ ... }")
+                i = o.matchingBrace(content, i) + 1
+            } else {
+                out.WriteByte(c)
+                i++
+            }
+            header.Reset()
+
+        case c == '}' || c == ';':
+            out.WriteByte(c)
+            header.Reset()
+            i++
+
+        default:
+            out.WriteByte(c)
+            header.WriteByte(c)
+            i++
+        }
+    }
+
+    return out.String(), nil
+}
+
+// matchingBrace returns the index of the brace closing the one at open,
+// skipping over strings, char literals and comments.
+func (o braceOutliner) matchingBrace(content string, open int) int {
+    depth := 0
+    for i := open; i < len(content); {
+        c := content[i]
+        switch {
+        case o.syntax.blockStart != "" && strings.HasPrefix(content[i:], o.syntax.blockStart):
+            end := strings.Index(content[i+len(o.syntax.blockStart):], o.syntax.blockEnd)
+            if end < 0 {
+                return len(content) - 1
+            }
+            i += len(o.syntax.blockStart) + end + len(o.syntax.blockEnd)
+        case isLineComment(content, i, o.syntax):
+            end := strings.IndexByte(content[i:], '\n')
+            if end < 0 {
+                return len(content) - 1
+            }
+            i += end
+        case isLiteralStart(content, i, o.syntax):
+            i = skipLiteral(content, i, o.syntax)
+        default:
+            if c == '{' {
+                depth++
+            } else if c == '}' {
+                depth--
+                if depth == 0 {
+                    return i
+                }
+            }
+            i++
+        }
+    }
+    return len(content) - 1
+}
+
+var (
+    headerSpaceRe = regexp.MustCompile(`\s+`)
+    annotationRe  = regexp.MustCompile(`@[\w.]+(\([^)]*\))?\s*`)
+    controlFlowRe = regexp.MustCompile(`^(if|else|for|while|do|switch|catch|try|finally|with|synchronized|return)\b`)
+    jsMethodRe    = regexp.MustCompile(`^((public|private|protected|static|async|get|set|readonly|override|abstract)\s+)*\*?\s*[\w$#\[\]"']+\s*(<[^>]*>)?\s*\(.*\)\s*(:\s*.+)?$`)
+    javaMethodRe  = regexp.MustCompile(`\)\s*(throws\s+[\w.,\s<>]+)?$`)
+    rustFnRe      = regexp.MustCompile(`\bfn\b`)
+)
+
+func normalizeHeader(header string) string {
+    header = headerSpaceRe.ReplaceAllString(header, " ")
+    return strings.TrimSpace(annotationRe.ReplaceAllString(header, ""))
+}
+
+func isJSFunction(header string) bool {
+    if strings.Contains(header, "function") || strings.HasSuffix(header, "=>") {
+        return true
+    }
+    return !controlFlowRe.MatchString(header) && jsMethodRe.MatchString(header)
+}
+
+func isJavaMethod(header string) bool {
+    if strings.HasSuffix(header, "->") {
+        return true
+    }
+    return !controlFlowRe.MatchString(header) && javaMethodRe.MatchString(header)
+}
+
+func isRustFunction(header string) bool {
+    return rustFnRe.MatchString(header)
+}
@@ -0,0 +1,103 @@
+package main
+
+import "testing"
+
+func TestOutliners(t *testing.T) {
+    tests := []struct {
+        name     string
+        language string
+        input    string
+        want     string
+    }{
+        {
+            name:     "go bodies and their comments",
+            language: "Go",
+            input:    "package p\n\nimport \"fmt\"\n\n// F prints.\nfunc F() {\n\t// inside\n\tfmt.Println(\"}\")\n}\n\ntype T struct{ A int }\n",
+            want:     "package p\n\nimport \"fmt\"\n\n// F prints.\nfunc F()\n\ntype T struct{ A int }\n",
+        },
+        {
+            name:     "python docstrings and multi-line signatures",
+            language: "Python",
+            input:    "import os\n\n\ndef f(x):\n    \"\"\"Doc.\"\"\"\n    y = x\n    return y\n\n\nclass C:\n    def m(self,\n          a):\n        return a\n",
+            want:     "import os\n\n\ndef f(x):\n    \"\"\"Doc.\"\"\"\n    ...\n\nclass C:\n    def m(self,\n          a):\n        ...\n",
+        },
+        {
+            name:     "python comment at column 0 inside a body",
+            language: "Python",
+            input:    "def f(x):\n    y = x\n# comment at col 0\n\n    return y\n\n# About g\ndef g(): return 1\n",
+            want:     "def f(x):\n    ...\n\n# About g\ndef g(): return 1\n",
+        },
+        {
+            name:     "python comments after a body",
+            language: "Python",
+            input:    "def f():\n    pass\n    # indented trailing comment\n# module comment\nx = 1\n",
+            want:     "def f():\n    ...\n# module comment\nx = 1\n",
+        },
+        {
+            name:     "javascript functions, methods and arrows",
+            language: "JavaScript",
+            input:    "import x from 'y';\n\nfunction f(a) {\n  if (a) { return '}'; }\n}\n\nclass C {\n  m(b) {\n    return `${b}}`;\n  }\n}\n\nconst g = (a) => {\n  return a;\n};\n",
+            want:     "import x from 'y';\n\nfunction f(a) { ... }\n\nclass C {\n  m(b) { ... }\n}\n\nconst g = (a) => { ... };\n",
+        },
+        {
+            name:     "javascript regex literals with braces",
+            language: "JavaScript",
+            input:    "function f(s) {\n  return /[{]\\/*/.test(s);\n}\n\nfunction g() {\n  return 1;\n}\n",
+            want:     "function f(s) { ... }\n\nfunction g() { ... }\n",
+        },
+        {
+            name:     "typescript interfaces are kept",
+            language: "TypeScript",
+            input:    "interface I {\n  m(): void;\n}\n\nexport function f(a: string): number {\n  return a.length;\n}\n",
+            want:     "interface I {\n  m(): void;\n}\n\nexport function f(a: string): number { ... }\n",
+        },
+        {
+            name:     "java methods with annotations and throws",
+            language: "Java",
+            input:    "public class A {\n    @Override\n    public String toString() {\n        return \"}\";\n    }\n\n    void run() throws Exception {\n        if (x) { y(); }\n    }\n}\n",
+            want:     "public class A {\n    @Override\n    public String toString() { ... }\n\n    void run() throws Exception { ... }\n}\n",
+        },
+        {
+            name:     "rust char literals and lifetimes",
+            language: "Rust",
+            input:    "fn parse(c: char) -> bool {\n    if c == '{' { return true }\n    c == '}' || c == '\\'' || c == '\\u{7D}'\n}\n\npub struct Point<'a> {\n    name: &'a str,\n}\n\nimpl<'a> Point<'a> {\n    fn name(&self) -> &'a str {\n        self.name\n    }\n}\n",
+            want:     "fn parse(c: char) -> bool { ... }\n\npub struct Point<'a> {\n    name: &'a str,\n}\n\nimpl<'a> Point<'a> {\n    fn name(&self) -> &'a str { ... }\n}\n",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := outliners[tt.language].Outline(tt.input)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got != tt.want {
+                t.Errorf("outline of\n%s\ngot\n%s\nwant\n%s", tt.input, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCharLiteralEnd(t *testing.T) {
+    tests := []struct {
+        input string
+        want  int
+    }{
+        {"'x'", 3},
+        {"'{' }", 3},
+        {`'\''`, 4},
+        {`'\n'`, 4},
+        {`'\x7f'`, 6},
+        {`'\u{1F600}'`, 11},
+        {"'é'", 4},
+        {"'a str", -1},
+        {"'a>", -1},
+        {"'", -1},
+    }
+
+    for _, tt := range tests {
+        if got := charLiteralEnd(tt.input, 0); got != tt.want {
+            t.Errorf("charLiteralEnd(%q) = %d, want %d", tt.input, got, tt.want)
+        }
+    }
+}
@@ -5,8 +5,9 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"unicode"
 
 	"github.com/atotto/clipboard"
 )
@@ -19,29 +20,48 @@ const (
     INDENT_PIPE = "│ "
 )
 
-func generateOutput(entries []FileEntry, format string, useClip bool) error {
+func generateOutput(entries []FileEntry, header string, cfg *Config) error {
     var contentBuf, treeBuf, tokenBuf bytes.Buffer
 
-    switch format {
+    if cfg.Secrets == "fail" {
+        var findings []string
+        for _, entry := range entries {
+            for _, secret := range entry.Secrets {
+                findings = append(findings, fmt.Sprintf("  %s: %s", secret.location(entry.Path), secret.Rule))
+            }
+        }
+        if len(findings) > 0 {
+            return fmt.Errorf("found %d possible secrets:\n%s", len(findings), strings.Join(findings, "\n"))
+        }
+    }
+
+    switch cfg.Output {
     case "tree":
-        if err := printTree(entries, &treeBuf); err != nil {
+        if err := printTree(entries, cfg, &treeBuf); err != nil {
             return err
         }
         if err := printTokenSummary(entries, &tokenBuf); err != nil {
             return err
         }
     case "files":
-        if err := printFiles(entries, &contentBuf); err != nil {
+        if err := printFiles(entries, cfg.LineNumbers, &contentBuf); err != nil {
             return err
         }
         if err := printTokenSummary(entries, &tokenBuf); err != nil {
             return err
         }
     case "both":
-        if err := printFiles(entries, &contentBuf); err != nil {
+        if err := printFiles(entries, cfg.LineNumbers, &contentBuf); err != nil {
             return err
         }
-        if err := printTree(entries, &treeBuf); err != nil {
+        if err := printTree(entries, cfg, &treeBuf); err != nil {
+            return err
+        }
+        if err := printTokenSummary(entries, &tokenBuf); err != nil {
+            return err
+        }
+    case "diff":
+        if err := printDiffs(entries, &contentBuf); err != nil {
             return err
         }
         if err := printTokenSummary(entries, &tokenBuf); err != nil {
@@ -51,6 +71,10 @@ func generateOutput(entries []FileEntry, format string, useClip bool) error {
         return fmt.Errorf("invalid output format specified")
     }
     
+    if header != "" {
+        fmt.Print(header)
+    }
+
     if contentBuf.Len() > 0 {
         fmt.Print(contentBuf.String())
     }
@@ -67,8 +91,9 @@ func generateOutput(entries []FileEntry, format string, useClip bool) error {
         fmt.Print(tokenBuf.String())
     }
 
-    if useClip {
+    if cfg.UseClip {
         var clipBuf bytes.Buffer
+        clipBuf.WriteString(header)
         clipBuf.Write(contentBuf.Bytes())
         if contentBuf.Len() > 0 && treeBuf.Len() > 0 {
             clipBuf.WriteString("\nDirectory Structure:\n")
@@ -107,12 +132,151 @@ func printTokenSummary(entries []FileEntry, buf *bytes.Buffer) error {
         fmt.Fprintf(buf, "Usage: %.1f%%\n", float64(totalTokens)/float64(maxTokenLimit)*100)
     }
 
+    printLanguageSummary(entries, buf)
+    printTransformSavings(entries, totalTokens, buf)
+    printSecretFindings(entries, buf)
+
+    encodings := make(map[string]int)
+    for _, entry := range entries {
+        if entry.Encoding != "" && entry.Encoding != EncodingUTF8 {
+            encodings[entry.Encoding]++
+        }
+    }
+    if len(encodings) > 0 {
+        names := make([]string, 0, len(encodings))
+        for name := range encodings {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+
+        parts := make([]string, len(names))
+        for i, name := range names {
+            parts[i] = fmt.Sprintf("%s (%d)", name, encodings[name])
+        }
+        fmt.Fprintf(buf, "Transcoded to UTF-8: %s\n", strings.Join(parts, ", "))
+    }
+
     return nil
 }
 
-func printFiles(entries []FileEntry, buf *bytes.Buffer) error {
+func printTransformSavings(entries []FileEntry, totalTokens int, buf *bytes.Buffer) {
+    savings := make(map[string]int)
+    saved := 0
+    for _, entry := range entries {
+        for name, n := range entry.Savings {
+            savings[name] += n
+            saved += n
+        }
+    }
+    if len(savings) == 0 {
+        return
+    }
+
+    names := make([]string, 0, len(savings))
+    for name := range savings {
+        names = append(names, name)
+    }
+    sort.Slice(names, func(i, j int) bool {
+        return savings[names[i]] > savings[names[j]]
+    })
+
+    original := totalTokens + saved
+    buf.WriteString("\nTransform Savings:\n")
+    for _, name := range names {
+        perc := 0.0
+        if original > 0 {
+            perc = float64(savings[name]) / float64(original) * 100
+        }
+        fmt.Fprintf(buf, "  %-18s %10d tokens (%.1f%%)\n", name, savings[name], perc)
+    }
+    fmt.Fprintf(buf, "  %-18s %10d tokens (%d before transforms)\n", "total", saved, original)
+}
+
+func printSecretFindings(entries []FileEntry, buf *bytes.Buffer) {
+    var total int
+    for _, entry := range entries {
+        total += len(entry.Secrets)
+    }
+    if total == 0 {
+        return
+    }
+
+    fmt.Fprintf(buf, "\nRedacted Secrets (%d):\n", total)
+    for _, entry := range entries {
+        for _, secret := range entry.Secrets {
+            fmt.Fprintf(buf, "  %s: %s\n", secret.location(entry.Path), secret.Rule)
+        }
+    }
+}
+
+type languageStats struct {
+    name   string
+    files  int
+    lines  int
+    bytes  int64
+    tokens int
+}
+
+func printLanguageSummary(entries []FileEntry, buf *bytes.Buffer) {
+    byLanguage := make(map[string]*languageStats)
+    for _, entry := range entries {
+        name := entry.Language
+        if name == "" {
+            name = "Other"
+        }
+        stats, ok := byLanguage[name]
+        if !ok {
+            stats = &languageStats{name: name}
+            byLanguage[name] = stats
+        }
+
+        stats.files++
+        stats.bytes += entry.Size
+        stats.lines += countLines(entry.Content)
+        if entry.TokenCount != nil {
+            stats.tokens += entry.TokenCount.Count
+        }
+    }
+    if len(byLanguage) == 0 {
+        return
+    }
+
+    languages := make([]*languageStats, 0, len(byLanguage))
+    for _, stats := range byLanguage {
+        languages = append(languages, stats)
+    }
+    sort.Slice(languages, func(i, j int) bool {
+        if languages[i].tokens != languages[j].tokens {
+            return languages[i].tokens > languages[j].tokens
+        }
+        return languages[i].name < languages[j].name
+    })
+
+    buf.WriteString("\nBy Language:\n")
+    fmt.Fprintf(buf, "  %-18s %7s %9s %10s %10s\n", "Language", "Files", "Lines", "Size", "Tokens")
+    for _, stats := range languages {
+        fmt.Fprintf(buf, "  %-18s %7d %9d %10s %10d\n",
+            stats.name, stats.files, stats.lines, formatSize(stats.bytes), stats.tokens)
+    }
+}
+
+func printFiles(entries []FileEntry, lineNumbers bool, buf *bytes.Buffer) error {
     for _, entry := range entries {
-        fmt.Fprintf(buf, "\nFile: %s\n", entry.Path)
+        var notes []string
+        if entry.StartLine > 1 {
+            notes = append(notes, fmt.Sprintf("from line %d", entry.StartLine))
+        }
+        if entry.Outlined {
+            notes = append(notes, "outline")
+        }
+        if entry.Generated != "" {
+            notes = append(notes, "generated: "+entry.Generated)
+        }
+        if len(notes) > 0 {
+            fmt.Fprintf(buf, "\nFile: %s (%s)\n", entry.Path, strings.Join(notes, ", "))
+        } else {
+            fmt.Fprintf(buf, "\nFile: %s\n", entry.Path)
+        }
         fmt.Fprintf(buf, "%s\n", strings.Repeat("=", 48))
 
         if entry.TokenCount != nil && entry.TokenCount.TokensPerc >= 80 {
@@ -120,137 +284,190 @@ func printFiles(entries []FileEntry, buf *bytes.Buffer) error {
                 entry.TokenCount.Count, entry.TokenCount.TokensPerc)
         }
 
-        formattedContent := formatFileContent(entry.Content)
-        fmt.Fprintf(buf, "%s\n", formattedContent)
+        if entry.Content != "" {
+            content := entry.Content
+            if lineNumbers {
+                content = numberLines(content, entry.StartLine)
+            }
+            fmt.Fprintf(buf, "%s\n", content)
+        }
+
+        if entry.Diff != "" {
+            fmt.Fprintf(buf, "\nDiff:\n%s", entry.Diff)
+        }
     }
 
     return nil
 }
 
-func formatFileContent(content string) string {
-    lines := strings.Split(content, "\n")
-    var formatted []string
-    indent := 0
+func countLines(content string) int {
+    if content == "" {
+        return 0
+    }
+    lines := strings.Count(content, "\n")
+    if !strings.HasSuffix(content, "\n") {
+        lines++
+    }
+    return lines
+}
+
+// numberLines prefixes each line with its number, starting at start and
+// padded to the width of the last number.
+func numberLines(content string, start int) string {
+    if start < 1 {
+        start = 1
+    }
+
+    lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+    width := len(strconv.Itoa(start + len(lines) - 1))
+
+    var buf strings.Builder
+    for i, line := range lines {
+        fmt.Fprintf(&buf, "%*d | %s\n", width, start+i, line)
+    }
+    return buf.String()
+}
 
-    for _, line := range lines {
-        trimmed := strings.TrimRightFunc(line, unicode.IsSpace)
-        if trimmed == "" {
-            formatted = append(formatted, "")
+func printDiffs(entries []FileEntry, buf *bytes.Buffer) error {
+    for _, entry := range entries {
+        if entry.Diff == "" {
             continue
         }
 
-        leadingSpace := countLeadingSpace(trimmed)
-        trimmed = strings.TrimSpace(trimmed)
-
-        if strings.HasSuffix(trimmed, "{") || strings.HasSuffix(trimmed, "[") {
-            formatted = append(formatted, strings.Repeat("  ", indent)+trimmed)
-            indent++
-        } else if strings.HasPrefix(trimmed, "}") || strings.HasPrefix(trimmed, "]") {
-            indent = max(0, indent-1)
-            formatted = append(formatted, strings.Repeat("  ", indent)+trimmed)
-        } else {
-            if leadingSpace > 0 {
-                indent = leadingSpace / 2
-            }
-            formatted = append(formatted, strings.Repeat("  ", indent)+trimmed)
+        buf.WriteString(entry.Diff)
+        if !strings.HasSuffix(entry.Diff, "\n") {
+            buf.WriteString("\n")
         }
     }
 
-    return strings.Join(formatted, "\n")
+    return nil
+}
+
+type treeNode struct {
+    name     string
+    path     string
+    isDir    bool
+    children []*treeNode
+    index    map[string]*treeNode
+    files    int
+    size     int64
+    tokens   int
 }
 
-func countLeadingSpace(s string) int {
-    count := 0
-    for _, r := range s {
-        if unicode.IsSpace(r) {
-            if r == '\t' {
-                count += 4 
-            } else {
-                count++
+// buildTree arranges entries into a directory tree, keeping the order in which
+// entries are given and summing file and token counts up to every directory.
+func buildTree(entries []FileEntry) *treeNode {
+    root := &treeNode{name: ".", path: ".", isDir: true, index: make(map[string]*treeNode)}
+
+    for _, entry := range entries {
+        tokens := 0
+        if entry.TokenCount != nil {
+            tokens = entry.TokenCount.Count
+        }
+
+        node := root
+        node.files++
+        node.size += entry.Size
+        node.tokens += tokens
+
+        parts := strings.Split(filepath.ToSlash(entry.Path), "/")
+        for i, part := range parts {
+            isDir := i < len(parts)-1
+            child, ok := node.index[part]
+            if !ok {
+                child = &treeNode{
+                    name:  part,
+                    path:  filepath.Join(node.path, part),
+                    isDir: isDir,
+                }
+                if isDir {
+                    child.index = make(map[string]*treeNode)
+                }
+                node.index[part] = child
+                node.children = append(node.children, child)
             }
-        } else {
-            break
+            child.files++
+            child.size += entry.Size
+            child.tokens += tokens
+            node = child
         }
     }
-    return count
+
+    return root
 }
 
-func max(a, b int) int {
-    if a > b {
-        return a
+func (n *treeNode) countDirs() int {
+    if !n.isDir {
+        return 0
+    }
+    count := 1
+    for _, child := range n.children {
+        count += child.countDirs()
     }
-    return b
+    return count
+}
+
+type treeOptions struct {
+    tokens      bool
+    maxDepth    int
+    total       int
+    highlightAt int
 }
 
-func printTree(entries []FileEntry, buf *bytes.Buffer) error {
+func printTree(entries []FileEntry, cfg *Config, buf *bytes.Buffer) error {
     if len(entries) == 0 {
         return nil
     }
 
-    buf.WriteString(".\n")
+    root := buildTree(entries)
+    opts := treeOptions{
+        tokens:      cfg.TreeTokens,
+        maxDepth:    cfg.TreeDepth,
+        total:       root.tokens,
+        highlightAt: int(cfg.TreeHighlight / 100 * float64(cfg.TokenLimit)),
+    }
 
-    root := make(map[string][]string)
-    for _, entry := range entries {
-        dir := filepath.Dir(entry.Path)
-        if dir == "." {
-            root[dir] = append(root[dir], entry.Path)
-        } else {
-            parts := strings.Split(dir, string(filepath.Separator))
-            current := ""
-            for i, part := range parts {
-                if i == 0 {
-                    current = part
-                } else {
-                    current = filepath.Join(current, part)
-                }
-                if _, exists := root[current]; !exists {
-                    parent := "."
-                    if i > 0 {
-                        parent = filepath.Join(parts[:i]...)
-                    }
-                    root[parent] = append(root[parent], current)
-                }
-            }
-            root[dir] = append(root[dir], entry.Path)
-        }
+    buf.WriteString(".")
+    if opts.tokens {
+        fmt.Fprintf(buf, " (%d tokens)", root.tokens)
     }
+    buf.WriteString("\n")
 
-    printNode(root, ".", "", "", buf)
+    printNode(root, "", 1, opts, buf)
 
-    dirs := len(root)
-    files := 0
-    for _, entry := range entries {
-        if !strings.HasSuffix(entry.Path, "/") {
-            files++
-        }
-    }
-    fmt.Fprintf(buf, "\n%d directories, %d files\n", dirs, files)
+    fmt.Fprintf(buf, "\n%d directories, %d files\n", root.countDirs(), root.files)
 
     return nil
 }
 
-func printNode(tree map[string][]string, node, prefix, childPrefix string, buf *bytes.Buffer) {
-    children := tree[node]
-    if len(children) == 0 {
-        return
-    }
+func printNode(node *treeNode, prefix string, depth int, opts treeOptions, buf *bytes.Buffer) {
+    for i, child := range node.children {
+        isLast := i == len(node.children)-1
 
-    for i, child := range children {
-        isLast := i == len(children)-1
-        if _, exists := tree[child]; exists {
-            if isLast {
-                fmt.Fprintf(buf, "%s%s %s\n", prefix, LAST_BRANCH, filepath.Base(child))
-                printNode(tree, child, childPrefix+INDENT, childPrefix+INDENT, buf)
-            } else {
-                fmt.Fprintf(buf, "%s%s %s\n", prefix, BRANCH, filepath.Base(child))
-                printNode(tree, child, childPrefix+INDENT_PIPE, childPrefix+INDENT_PIPE, buf)
+        branch, childPrefix := BRANCH, prefix+INDENT_PIPE
+        if isLast {
+            branch, childPrefix = LAST_BRANCH, prefix+INDENT
+        }
+
+        collapsed := child.isDir && opts.maxDepth > 0 && depth >= opts.maxDepth
+        fmt.Fprintf(buf, "%s%s %s", prefix, branch, child.name)
+        if collapsed {
+            fmt.Fprintf(buf, "/ (%d files)", child.files)
+        }
+        if opts.tokens {
+            perc := 0.0
+            if opts.total > 0 {
+                perc = float64(child.tokens) / float64(opts.total) * 100
             }
-        } else {
-            if isLast {
-                fmt.Fprintf(buf, "%s%s %s\n", prefix, LAST_BRANCH, filepath.Base(child))
-            } else {
-                fmt.Fprintf(buf, "%s%s %s\n", prefix, BRANCH, filepath.Base(child))
+            fmt.Fprintf(buf, " [%d tokens, %.1f%%]", child.tokens, perc)
+            if opts.highlightAt > 0 && child.tokens > opts.highlightAt {
+                buf.WriteString(" ⚠️")
             }
         }
+        buf.WriteString("\n")
+
+        if child.isDir && !collapsed {
+            printNode(child, childPrefix, depth+1, opts, buf)
+        }
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+    tests := []struct {
+        input   string
+        pattern string
+        want    *LineRange
+        wantErr bool
+    }{
+        {"*.go", "*.go", nil, false},
+        {"server.go:120-180", "server.go", &LineRange{Pattern: "server.go", Start: 120, End: 180}, false},
+        {"server.go:42", "server.go", &LineRange{Pattern: "server.go", Start: 42, End: 42}, false},
+        {"C:/src/a.go:1-2", "C:/src/a.go", &LineRange{Pattern: "C:/src/a.go", Start: 1, End: 2}, false},
+        {"a.go:0-3", "", nil, true},
+        {"a.go:9-3", "", nil, true},
+        {"a.go:x-3", "a.go:x-3", nil, false},
+    }
+
+    for _, tt := range tests {
+        pattern, lineRange, err := parseLineRange(tt.input)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("parseLineRange(%q) error = %v, want error %v", tt.input, err, tt.wantErr)
+            continue
+        }
+        if pattern != tt.pattern || (lineRange == nil) != (tt.want == nil) || (lineRange != nil && *lineRange != *tt.want) {
+            t.Errorf("parseLineRange(%q) = %q, %+v; want %q, %+v", tt.input, pattern, lineRange, tt.pattern, tt.want)
+        }
+    }
+}
+
+func TestNumberLines(t *testing.T) {
+    tests := []struct {
+        content string
+        start   int
+        want    string
+    }{
+        {"a\nb\n", 1, "1 | a\n2 | b\n"},
+        {"a\nb", 0, "1 | a\n2 | b\n"},
+        {"x\ny\nz\n", 98, " 98 | x\n 99 | y\n100 | z\n"},
+        {"\n", 5, "5 | \n"},
+    }
+
+    for _, tt := range tests {
+        if got := numberLines(tt.content, tt.start); got != tt.want {
+            t.Errorf("numberLines(%q, %d) = %q, want %q", tt.content, tt.start, got, tt.want)
+        }
+    }
+}
+
+func TestLineRangeNumbersMatchSource(t *testing.T) {
+    cfg := &Config{Path: "/repo", LineRanges: []LineRange{{Pattern: "a.txt", Start: 3, End: 4}}}
+    a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude)}
+
+    entry, err := a.createFileEntry("/repo/a.txt", []byte("one\ntwo\nthree\nfour\nfive\n"), 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, want := numberLines(entry.Content, entry.StartLine), "3 | three\n4 | four\n"; got != want {
+        t.Errorf("numbered %q, want %q", got, want)
+    }
+}
+
+func TestPrintLanguageSummary(t *testing.T) {
+    entries := []FileEntry{
+        {Path: "a.go", Language: "Go", Content: "package a\n\nfunc A() {}\n", Size: 2048, TokenCount: &TokenCount{Count: 30}},
+        {Path: "b.go", Language: "Go", Content: "package b", Size: 10, TokenCount: &TokenCount{Count: 5}},
+        {Path: "c.py", Language: "Python", Content: "x = 1\n", Size: 6, TokenCount: &TokenCount{Count: 35}},
+        {Path: "LICENSE", Content: "MIT\n", Size: 4},
+    }
+
+    var buf bytes.Buffer
+    printLanguageSummary(entries, &buf)
+    want := "\nBy Language:\n" +
+        "  Language             Files     Lines       Size     Tokens\n" +
+        "  Go                       2         4     2.0 KB         35\n" +
+        "  Python                   1         1        6 B         35\n" +
+        "  Other                    1         1        4 B          0\n"
+    if got := buf.String(); got != want {
+        t.Errorf("got\n%s\nwant\n%s", got, want)
+    }
+
+    buf.Reset()
+    printLanguageSummary(nil, &buf)
+    if buf.Len() != 0 {
+        t.Errorf("summary of no files: %q", buf.String())
+    }
+}
@@ -44,6 +44,17 @@ func (pm *PatternMatcher) ShouldProcess(path string) bool {
 	return true
 }
 
+// IsExcluded reports whether path matches an exclude pattern, ignoring the
+// include patterns. Used to prune whole directories.
+func (pm *PatternMatcher) IsExcluded(path string) bool {
+	for _, pattern := range pm.excludePatterns {
+		if matchPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
 func matchPattern(pattern, path string) bool {
     path = filepath.ToSlash(path)
     pattern = filepath.ToSlash(pattern)
@@ -93,4 +104,45 @@ func defaultExcludes() []string {
         
         "__pycache__", ".mypy_cache", ".pytest_cache",
     }
-}
\ No newline at end of file
+}
+
+// sensitivePatterns lists files that commonly hold credentials. Unlike
+// defaultExcludes they are not replaced by --exclude and cannot be pulled
+// back in with --include; only --allow-sensitive lets them through.
+func sensitivePatterns() []string {
+    return []string{
+        ".env", ".env.*", "*.env",
+        ".npmrc", ".pypirc", ".netrc", ".pgpass", ".htpasswd", ".git-credentials",
+        "credentials", "credentials.json", "service-account*.json",
+        ".docker/config.json", ".kube/config", "kubeconfig", "*.kubeconfig",
+        "id_rsa", "id_dsa", "id_ecdsa", "id_ed25519",
+        "*.pem", "*.key", "*.p12", "*.pfx", "*.jks", "*.keystore", "*.kdbx",
+        "*.tfstate", "*.tfstate.backup",
+    }
+}
+
+// Templates for .env files hold placeholders, not secrets.
+var sensitiveExceptions = []string{".env.example", ".env.sample", ".env.template", ".env.dist"}
+
+func isSensitive(path string) bool {
+    base := filepath.Base(path)
+    for _, exception := range sensitiveExceptions {
+        if base == exception {
+            return false
+        }
+    }
+
+    // Match names against the file itself, so a directory called
+    // "credentials" does not hide everything inside it
+    path = filepath.ToSlash(path)
+    for _, pattern := range sensitivePatterns() {
+        if strings.Contains(pattern, "/") {
+            if path == pattern || strings.HasSuffix(path, "/"+pattern) {
+                return true
+            }
+        } else if matched, _ := filepath.Match(pattern, base); matched {
+            return true
+        }
+    }
+    return false
+}
@@ -1,30 +1,93 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
 type FilePicker struct {
-    app       *tview.Application
-    list      *tview.List
-    search    *tview.InputField
-    files     []FileEntry
-    filtered  []FileEntry
-    selected  []FileEntry
-    onDone    func([]FileEntry)
+    app          *tview.Application
+    pages        *tview.Pages
+    layout       *tview.Flex
+    panes        *tview.Flex
+    help         *tview.TextView
+    helpVisible  bool
+    modal        tview.Primitive
+    root         string
+    tree         *tview.TreeView
+    search       *tview.InputField
+    notice       *tview.TextView
+    status       *tview.TextView
+    message      string
+    warnings     []string
+    searching    bool
+    preview      *tview.TextView
+    previewPath  string
+    load         func(path string) (FileEntry, error)
+    split        func(paths []string) (missing, excluded []string, err error)
+    queue        *tokenQueue
+    threads      int
+    unloaded     map[string]bool
+    skipped      map[string]bool
+    failed       map[string]error
+    limit        int
+    strict       bool
+    files        []FileEntry
+    index        map[string]int
+    filtered     []FileEntry
+    matches      map[string][]int
+    selected     map[string]bool
+    collapsed    map[string]bool
+    sortOrder    int
+    selectedOnly bool
+    keymap       *Keymap
+    theme        Theme
+    result       []FileEntry
+    confirmed    bool
 }
 
-func NewFilePicker(files []FileEntry, onDone func([]FileEntry)) *FilePicker {
+func NewFilePicker(files []FileEntry, cfg *Config) *FilePicker {
     picker := &FilePicker{
-        app:      tview.NewApplication(),
-        files:    files,
-        filtered: files,
-        onDone:   onDone,
+        app:       tview.NewApplication(),
+        root:      cfg.Path,
+        limit:     cfg.TokenLimit,
+        strict:    cfg.StrictBudget,
+        files:     files,
+        filtered:  files,
+        selected:  make(map[string]bool),
+        collapsed: make(map[string]bool),
+        threads:   cfg.Threads,
+        unloaded:  make(map[string]bool),
+        skipped:   make(map[string]bool),
+        failed:    make(map[string]error),
+        index:     make(map[string]int, len(files)),
+        keymap:    cfg.Keymap,
+        theme:     cfg.Theme,
+    }
+    if picker.keymap == nil {
+        picker.keymap, _ = NewKeymap("", nil)
+    }
+    if picker.theme == nil {
+        picker.theme, _ = NewTheme("", nil)
+    }
+    if picker.threads <= 0 {
+        picker.threads = runtime.NumCPU()
+    }
+    for i, file := range files {
+        picker.index[file.Path] = i
+        if file.TokenCount == nil && file.Content == "" && file.Diff == "" {
+            picker.unloaded[file.Path] = true
+        }
     }
 
     picker.setupUI()
@@ -32,18 +95,19 @@ func NewFilePicker(files []FileEntry, onDone func([]FileEntry)) *FilePicker {
 }
 
 func (fp *FilePicker) setupUI() {
-    flex := tview.NewFlex().SetDirection(tview.FlexRow)
-
-    helpText := tview.NewTextView().
-        SetText("Controls:\n" +
-            "↑/↓      : Navigate files\n" +
-            "Space    : Select/deselect file\n" +
-            "Tab      : Switch between search and list\n" +
-            "/        : Focus search\n" +
-            "Enter    : Confirm selection\n" +
-            "Esc      : Cancel").
-        SetTextAlign(tview.AlignLeft).
-        SetDynamicColors(true)
+    tview.Styles.PrimitiveBackgroundColor = fp.theme.Color("background")
+    tview.Styles.ContrastBackgroundColor = fp.theme.Color("input")
+    tview.Styles.PrimaryTextColor = fp.theme.Color("text")
+    tview.Styles.BorderColor = fp.theme.Color("border")
+    tview.Styles.TitleColor = fp.theme.Color("text")
+    tview.Styles.GraphicsColor = fp.theme.Color("muted")
+
+    fp.help = tview.NewTextView().
+        SetTextAlign(tview.AlignLeft)
+    fp.setHelpVisible(false)
+
+    fp.notice = tview.NewTextView().
+        SetTextColor(fp.theme.Color("warning"))
 
     fp.search = tview.NewInputField().
         SetLabel("Search: ").
@@ -51,122 +115,1019 @@ func (fp *FilePicker) setupUI() {
         SetChangedFunc(fp.onSearch).
         SetDoneFunc(func(key tcell.Key) {
             if key == tcell.KeyEnter {
-                fp.app.SetFocus(fp.list)
+                fp.app.SetFocus(fp.tree)
             }
         })
 
-    fp.list = tview.NewList().
-        ShowSecondaryText(true).
-        SetHighlightFullLine(true).
-        SetSelectedBackgroundColor(tcell.ColorRoyalBlue)
+    fp.tree = tview.NewTreeView().
+        SetTopLevel(1).
+        SetGraphicsColor(fp.theme.Color("muted")).
+        SetChangedFunc(fp.showPreview).
+        SetSelectedFunc(func(node *tview.TreeNode) {
+            // Only reached by clicking, as keys are handled by the keymap
+            fp.toggleSelection(node.GetReference().(*treeNode))
+        })
+
+    // The wheel moves the highlight rather than just scrolling the view
+    fp.tree.SetMouseCapture(func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+        switch action {
+        case tview.MouseScrollUp:
+            fp.tree.Move(-1)
+            return action, nil
+        case tview.MouseScrollDown:
+            fp.tree.Move(1)
+            return action, nil
+        }
+        return action, event
+    })
 
-    fp.updateList("")
+    fp.preview = tview.NewTextView().
+        SetDynamicColors(true).
+        SetWrap(false)
+    fp.preview.SetBorder(true)
 
-    fp.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-        switch event.Key() {
-        case tcell.KeyEnter:
-            fp.onDone(fp.selected)
-            fp.app.Stop()
-            return nil
-        case tcell.KeyEsc:
-			fp.onDone(nil)
-            fp.app.Stop()
-            return nil
-        case tcell.KeyRune:
-            if event.Rune() == '/' {
-                fp.app.SetFocus(fp.search)
-                return nil
-            }
-			if event.Rune() == ' ' {
-				if idx := fp.list.GetCurrentItem(); idx >= 0 && idx < len(fp.filtered) {
-					fp.toggleSelection(fp.filtered[idx])
-					return nil
-				}
-	 		}
-	}
-        return event
-})
+    fp.status = tview.NewTextView().
+        SetDynamicColors(true)
+
+    fp.updateTree("")
+    fp.updateStatus("")
 
     fp.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-        switch event.Key() {
-		case tcell.KeyCtrlC:
-			fp.onDone(nil)
-			fp.app.Stop()
-			return nil
-        case tcell.KeyTab:
-            if fp.app.GetFocus() == fp.search {
-                fp.app.SetFocus(fp.list)
-            } else {
-                fp.app.SetFocus(fp.search)
+        if event.Key() == tcell.KeyCtrlC {
+            fp.finish(nil, false)
+            return nil
+        }
+        if fp.modal != nil {
+            return event
+        }
+        fp.dismissMessage()
+
+        if fp.app.GetFocus() == fp.search {
+            // Leave typing to the search box; only keys that cannot be typed
+            // may switch away from it
+            if event.Key() == tcell.KeyRune {
+                return event
             }
+            switch action := fp.keymap.Lookup(keyName(event)); action {
+            case "switch-focus", "save", "load":
+                return fp.runAction(action, event)
+            }
+            return event
+        }
+
+        // In the tree the keymap is authoritative, so keys it does not bind
+        // are dropped rather than falling through to tview's defaults
+        action, _ := fp.keymap.Action(event)
+        if action == "" {
             return nil
         }
-        return event
+        return fp.runAction(action, event)
+    })
+
+    // Clicks outside an open dialog must not reach the picker behind it
+    fp.app.SetMouseCapture(func(event *tcell.EventMouse, action tview.MouseAction) (*tcell.EventMouse, tview.MouseAction) {
+        if fp.modal == nil {
+            if action == tview.MouseLeftClick {
+                fp.dismissMessage()
+            }
+            return event, action
+        }
+        x, y := event.Position()
+        mx, my, mw, mh := fp.modal.GetRect()
+        if x < mx || x >= mx+mw || y < my || y >= my+mh {
+            return nil, action
+        }
+        return event, action
     })
 
-    flex.AddItem(helpText, 7, 0, false).   
+    fp.panes = tview.NewFlex().
+        AddItem(fp.tree, 0, 1, true).
+        AddItem(fp.preview, 0, 1, false)
+
+    fp.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+        AddItem(fp.help, 1, 0, false).
+        AddItem(fp.notice, 1, 0, false).
         AddItem(fp.search, 1, 0, false).
-        AddItem(fp.list, 0, 1, true)
+        AddItem(fp.panes, 0, 1, true).
+        AddItem(fp.status, 1, 0, false)
+
+    fp.app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+        fp.resize(screen.Size())
+        return false
+    })
 
-    fp.app.SetRoot(flex, true).SetFocus(fp.list)
+    fp.pages = tview.NewPages().AddPage("picker", fp.layout, true, true)
+    fp.app.EnableMouse(true).SetRoot(fp.pages, true).SetFocus(fp.tree)
 }
 
-func (fp *FilePicker) toggleSelection(file FileEntry) {
-    currentIndex := fp.list.GetCurrentItem() 
-    
-    for i, sel := range fp.selected {
-        if sel.Path == file.Path {
-            fp.selected = append(fp.selected[:i], fp.selected[i+1:]...)
-            fp.updateList(fp.search.GetText())
-            fp.list.SetCurrentItem(currentIndex) 
+const (
+    // Below this width the preview goes under the tree instead of beside it
+    sideBySideWidth = 100
+    // Below this height a stacked preview is hidden altogether
+    stackedMinHeight = 20
+)
+
+// resize adapts the panes to the terminal size. It runs before every draw,
+// so it also handles the terminal being resized.
+func (fp *FilePicker) resize(width, height int) {
+    if width >= sideBySideWidth {
+        fp.panes.SetDirection(tview.FlexColumn)
+        fp.panes.ResizeItem(fp.preview, 0, 1)
+    } else {
+        fp.panes.SetDirection(tview.FlexRow)
+        if height >= stackedMinHeight {
+            fp.panes.ResizeItem(fp.preview, 0, 1)
+        } else {
+            fp.panes.ResizeItem(fp.preview, 0, 0)
+        }
+    }
+
+    // Expanded help may take at most a third of the screen
+    lines := strings.Count(fp.help.GetText(false), "\n") + 1
+    fp.layout.ResizeItem(fp.help, min(lines, max(height/3, 1)), 0)
+}
+
+// setHelpVisible shows the key bindings, or a one-line hint on how to show
+// them.
+func (fp *FilePicker) setHelpVisible(visible bool) {
+    fp.helpVisible = visible
+    if visible {
+        fp.help.SetText(fp.keymap.Help())
+    } else if keys := fp.keymap.keys["help"]; len(keys) > 0 {
+        fp.help.SetText(fmt.Sprintf("Press %s for key bindings", keys[0]))
+    } else {
+        fp.help.SetText("")
+    }
+}
+
+// showModal shows p centered over the picker until closeModal is called.
+func (fp *FilePicker) showModal(p tview.Primitive, width, height int) {
+    centered := tview.NewFlex().
+        AddItem(nil, 0, 1, false).
+        AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+            AddItem(nil, 0, 1, false).
+            AddItem(p, height, 0, true).
+            AddItem(nil, 0, 1, false), width, 0, true).
+        AddItem(nil, 0, 1, false)
+    fp.pages.AddPage("modal", centered, true, true)
+    fp.modal = p
+    fp.app.SetFocus(p)
+}
+
+func (fp *FilePicker) closeModal() {
+    fp.pages.RemovePage("modal")
+    fp.modal = nil
+    fp.app.SetFocus(fp.tree)
+}
+
+func (fp *FilePicker) promptSave() {
+    input := tview.NewInputField().SetLabel("Name: ").SetFieldWidth(0)
+    input.SetBorder(true).SetTitle(" Save selection as ")
+    input.SetDoneFunc(func(key tcell.Key) {
+        name := input.GetText()
+        fp.closeModal()
+        if key != tcell.KeyEnter || name == "" {
             return
         }
+
+        var paths []string
+        for _, file := range fp.selectedFiles() {
+            paths = append(paths, file.Path)
+        }
+        if err := SaveSelection(fp.root, name, paths); err != nil {
+            fp.updateStatus(fp.theme.Tag("error") + tview.Escape(err.Error()))
+            return
+        }
+        fp.updateStatus(fmt.Sprintf("%sSaved %d files as '%s'", fp.theme.Tag("ok"), len(paths), tview.Escape(name)))
+    })
+    fp.showModal(input, 50, 3)
+}
+
+func (fp *FilePicker) promptLoad() {
+    names, err := ListSelections(fp.root)
+    if err != nil {
+        fp.updateStatus(fp.theme.Tag("error") + tview.Escape(err.Error()))
+        return
+    }
+    if len(names) == 0 {
+        fp.updateStatus("No saved selections")
+        return
+    }
+
+    list := tview.NewList().ShowSecondaryText(false)
+    list.SetBorder(true).SetTitle(" Load selection ")
+    for _, name := range names {
+        name := name
+        list.AddItem(tview.Escape(name), "", 0, func() {
+            fp.closeModal()
+            fp.loadSelection(name)
+        })
+    }
+    list.SetDoneFunc(fp.closeModal)
+    fp.showModal(list, 50, min(len(names)+2, 15))
+}
+
+func (fp *FilePicker) loadSelection(name string) {
+    paths, err := LoadSelection(fp.root, name)
+    if err != nil {
+        fp.updateStatus(fp.theme.Tag("error") + tview.Escape(err.Error()))
+        return
+    }
+
+    selected, unlisted := fp.selectionOf(paths)
+    missing, excluded, err := fp.splitUnlisted(unlisted)
+    if err != nil {
+        fp.updateStatus(fp.theme.Tag("error") + tview.Escape(err.Error()))
+        return
+    }
+    if !fp.setSelected(selected) {
+        return
+    }
+
+    var problems []string
+    if len(missing) > 0 {
+        problems = append(problems, fmt.Sprintf("%d files not found: %s", len(missing), strings.Join(missing, ", ")))
+    }
+    if len(excluded) > 0 {
+        problems = append(problems, fmt.Sprintf("%d files excluded by the current filters: %s",
+            len(excluded), strings.Join(excluded, ", ")))
+    }
+    if len(problems) > 0 {
+        fp.updateStatus(fmt.Sprintf("%sLoaded '%s', %s", fp.theme.Tag("warning"),
+            tview.Escape(name), tview.Escape(strings.Join(problems, "; "))))
+        return
+    }
+    fp.updateStatus(fmt.Sprintf("%sLoaded '%s'", fp.theme.Tag("ok"), tview.Escape(name)))
+}
+
+// SetSelection replaces the selection with paths, returning those that are
+// not among the listed files, split into files that do not exist and files
+// the current filters exclude.
+func (fp *FilePicker) SetSelection(paths []string) (missing, excluded []string, err error) {
+    selected, unlisted := fp.selectionOf(paths)
+    missing, excluded, err = fp.splitUnlisted(unlisted)
+    if err != nil {
+        return nil, nil, err
+    }
+    fp.selected = selected
+    fp.updateTree(fp.search.GetText())
+    fp.prioritize()
+    fp.updateStatus("")
+    return missing, excluded, nil
+}
+
+func (fp *FilePicker) selectionOf(paths []string) (map[string]bool, []string) {
+    selected := make(map[string]bool)
+    var unlisted []string
+    for _, path := range paths {
+        if _, ok := fp.index[path]; ok && !fp.skipped[path] {
+            selected[path] = true
+        } else {
+            unlisted = append(unlisted, path)
+        }
+    }
+    return selected, unlisted
+}
+
+// splitUnlisted sorts selected paths the picker does not list into missing
+// and excluded ones. Without a splitter, all of them count as missing.
+func (fp *FilePicker) splitUnlisted(paths []string) (missing, excluded []string, err error) {
+    if fp.split == nil || len(paths) == 0 {
+        return paths, nil, nil
+    }
+    return fp.split(paths)
+}
+
+// setSelected replaces the selection, unless --strict-budget is set and the
+// change would take it further over the token limit.
+func (fp *FilePicker) setSelected(selected map[string]bool) bool {
+    if fp.strict && fp.limit > 0 {
+        tokens := fp.tokensIn(selected)
+        if tokens > fp.limit && tokens > fp.selectedTokens() {
+            fp.updateStatus(fmt.Sprintf("%sNot selected: would use %d of %d tokens", fp.theme.Tag("error"), tokens, fp.limit))
+            return false
+        }
+    }
+
+    fp.selected = selected
+    if fp.selectedOnly {
+        fp.updateTree(fp.search.GetText())
+    } else {
+        fp.refreshLabels()
+    }
+    fp.prioritize()
+    fp.updateStatus("")
+    return true
+}
+
+// runAction performs a keymap action. Movement is done by handing the tree
+// the key it already understands.
+func (fp *FilePicker) runAction(action string, event *tcell.EventKey) *tcell.EventKey {
+    node := fp.tree.GetCurrentNode()
+    switch action {
+    case "up":
+        return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+    case "down":
+        return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+    case "top", "bottom":
+        if nodes := fp.visibleNodes(); len(nodes) > 0 {
+            target := nodes[0]
+            if action == "bottom" {
+                target = nodes[len(nodes)-1]
+            }
+            fp.tree.SetCurrentNode(target)
+            fp.showPreview(target)
+        }
+    case "expand":
+        fp.setExpanded(node, true)
+    case "collapse":
+        if node != nil && node.IsExpanded() && len(node.GetChildren()) > 0 {
+            fp.setExpanded(node, false)
+        } else if path := fp.tree.GetPath(node); len(path) > 2 {
+            // The root is hidden, so stop at top-level entries
+            fp.tree.SetCurrentNode(path[len(path)-2])
+            fp.showPreview(path[len(path)-2])
+        }
+    case "toggle":
+        if node != nil {
+            fp.toggleSelection(node.GetReference().(*treeNode))
+        }
+    case "select-all":
+        fp.selectFiltered()
+    case "invert":
+        fp.invertSelection()
+    case "clear":
+        fp.clearSelection()
+    case "sort":
+        fp.sortOrder = (fp.sortOrder + 1) % len(sortOrders)
+        fp.updateTree(fp.search.GetText())
+    case "selected-only":
+        fp.selectedOnly = !fp.selectedOnly
+        fp.updateTree(fp.search.GetText())
+    case "preview-down", "preview-up":
+        _, _, _, height := fp.preview.GetInnerRect()
+        if action == "preview-up" {
+            height = -height
+        }
+        row, _ := fp.preview.GetScrollOffset()
+        fp.preview.ScrollTo(max(row+height, 0), 0)
+    case "search":
+        fp.app.SetFocus(fp.search)
+    case "help":
+        fp.setHelpVisible(!fp.helpVisible)
+    case "switch-focus":
+        if fp.app.GetFocus() == fp.search {
+            fp.app.SetFocus(fp.tree)
+        } else {
+            fp.app.SetFocus(fp.search)
+        }
+    case "save":
+        fp.promptSave()
+    case "load":
+        fp.promptLoad()
+    case "confirm":
+        fp.finish(fp.selectedFiles(), true)
+    case "cancel":
+        fp.finish(nil, false)
+    }
+    return nil
+}
+
+// visibleNodes returns the nodes not hidden inside collapsed directories, in
+// display order.
+func (fp *FilePicker) visibleNodes() []*tview.TreeNode {
+    var nodes []*tview.TreeNode
+    var walk func(node *tview.TreeNode)
+    walk = func(node *tview.TreeNode) {
+        for _, child := range node.GetChildren() {
+            nodes = append(nodes, child)
+            if child.IsExpanded() {
+                walk(child)
+            }
+        }
+    }
+    walk(fp.tree.GetRoot())
+    return nodes
+}
+
+func (fp *FilePicker) setExpanded(node *tview.TreeNode, expanded bool) {
+    if node == nil || len(node.GetChildren()) == 0 {
+        return
+    }
+    node.SetExpanded(expanded)
+    fp.collapsed[node.GetReference().(*treeNode).path] = !expanded
+}
+
+// toggleSelection selects every file under node, or deselects them all if
+// they were already selected.
+func (fp *FilePicker) toggleSelection(node *treeNode) {
+    paths := descendantFiles(node)
+    all := true
+    for _, path := range paths {
+        if !fp.selected[path] {
+            all = false
+            break
+        }
+    }
+
+    selected := fp.copySelection()
+    for _, path := range paths {
+        if all {
+            delete(selected, path)
+        } else {
+            selected[path] = true
+        }
+    }
+    fp.setSelected(selected)
+}
+
+// selectFiltered adds every file matching the search to the selection.
+func (fp *FilePicker) selectFiltered() {
+    selected := fp.copySelection()
+    for _, file := range fp.filtered {
+        selected[file.Path] = true
+    }
+    fp.setSelected(selected)
+}
+
+// invertSelection flips the selection of every file matching the search.
+func (fp *FilePicker) invertSelection() {
+    selected := fp.copySelection()
+    for _, file := range fp.filtered {
+        if selected[file.Path] {
+            delete(selected, file.Path)
+        } else {
+            selected[file.Path] = true
+        }
+    }
+    fp.setSelected(selected)
+}
+
+func (fp *FilePicker) clearSelection() {
+    fp.setSelected(make(map[string]bool))
+}
+
+func (fp *FilePicker) copySelection() map[string]bool {
+    selected := make(map[string]bool, len(fp.selected))
+    for path := range fp.selected {
+        selected[path] = true
+    }
+    return selected
+}
+
+func (fp *FilePicker) tokensOf(path string) int {
+    if file := fp.files[fp.index[path]]; file.TokenCount != nil {
+        return file.TokenCount.Count
+    }
+    return 0
+}
+
+func (fp *FilePicker) selectedTokens() int {
+    return fp.tokensIn(fp.selected)
+}
+
+func (fp *FilePicker) tokensIn(selected map[string]bool) int {
+    total := 0
+    for path := range selected {
+        total += fp.tokensOf(path)
+    }
+    return total
+}
+
+const gaugeWidth = 20
+
+// updateStatus shows the selection's size against the token limit, followed
+// by message if one is given.
+func (fp *FilePicker) updateStatus(message string) {
+    fp.message = message
+    tokens := fp.selectedTokens()
+    text := fmt.Sprintf("Selected: %d files, %d tokens", len(fp.selected), tokens)
+
+    counting := 0
+    for path := range fp.selected {
+        if fp.unloaded[path] {
+            counting++
+        }
+    }
+    if counting > 0 {
+        text += fmt.Sprintf(" (%d still counting)", counting)
+    }
+
+    if fp.limit > 0 {
+        perc := float64(tokens) / float64(fp.limit) * 100
+        color := "ok"
+        if perc > 100 {
+            color = "error"
+        } else if perc >= 80 {
+            color = "warning"
+        }
+
+        filled := int(perc / 100 * gaugeWidth)
+        if filled > gaugeWidth {
+            filled = gaugeWidth
+        }
+        text += fmt.Sprintf("  %s%s%s%s[-] %.1f%% of %d",
+            fp.theme.Tag(color), strings.Repeat("█", filled),
+            fp.theme.Tag("muted"), strings.Repeat("░", gaugeWidth-filled), perc, fp.limit)
+
+        if perc > 100 && message == "" {
+            message = fmt.Sprintf("%sOver budget by %d tokens", fp.theme.Tag("error"), tokens-fp.limit)
+        }
+    }
+
+    text += "  " + fp.theme.Tag("muted") + "sort: " + sortOrders[fp.sortOrder]
+    if fp.selectedOnly {
+        text += ", selected only"
+    }
+    if len(fp.unloaded) > 0 {
+        progress := "counting tokens"
+        if fp.searching {
+            progress = "searching"
+        }
+        text += fmt.Sprintf(", %s %d/%d", progress, len(fp.files)-len(fp.unloaded), len(fp.files))
+    }
+    text += "[-]"
+
+    if message != "" {
+        text += "  " + message
     }
+    fp.status.SetText(text)
+}
+
+// dismissMessage clears the status message once the user does something
+// else. Rebuilds in between, such as when files load, keep it.
+func (fp *FilePicker) dismissMessage() {
+    if fp.message != "" {
+        fp.updateStatus("")
+    }
+}
 
-    fp.selected = append(fp.selected, file)
-    fp.updateList(fp.search.GetText())
-    fp.list.SetCurrentItem(currentIndex)
+// selectedFiles returns the selected entries in listing order.
+func (fp *FilePicker) selectedFiles() []FileEntry {
+    var selected []FileEntry
+    for _, file := range fp.files {
+        if fp.selected[file.Path] {
+            selected = append(selected, file)
+        }
+    }
+    return selected
 }
 
 func (fp *FilePicker) onSearch(text string) {
-    fp.updateList(text)
+    fp.updateTree(text)
 }
 
-func (fp *FilePicker) updateList(search string) {
-    currentIndex := fp.list.GetCurrentItem() 
-    fp.list.Clear()
+func (fp *FilePicker) updateTree(search string) {
+    currentPath := ""
+    if current := fp.tree.GetCurrentNode(); current != nil {
+        currentPath = current.GetReference().(*treeNode).path
+    }
+
+    query, err := parseQuery(search)
+    if err != nil {
+        fp.updateStatus(fp.theme.Tag("error") + tview.Escape(err.Error()))
+        query = &searchQuery{}
+    } else if fp.status != nil {
+        fp.updateStatus(fp.message)
+    }
+    // Content searches only see loaded files and are rerun as more load
+    fp.searching = query.needsContent() && fp.load != nil
+
+    // Best fuzzy matches first; buildTree then orders each directory by its
+    // best match
+    var scores []int
     fp.filtered = []FileEntry{}
+    fp.matches = make(map[string][]int)
+    for _, file := range fp.files {
+        if fp.skipped[file.Path] || fp.selectedOnly && !fp.selected[file.Path] {
+            continue
+        }
+        if fp.searching && fp.unloaded[file.Path] {
+            continue
+        }
+        if ok, score, positions := query.match(file); ok {
+            fp.filtered = append(fp.filtered, file)
+            fp.matches[file.Path] = positions
+            scores = append(scores, score)
+        }
+    }
+    sort.Stable(byScore{fp.filtered, scores})
+
+    tree := buildTree(fp.filtered)
+    sortTree(tree, sortOrders[fp.sortOrder])
+    root := fp.buildNode(tree, search != "")
+    fp.tree.SetRoot(root)
+    fp.refreshLabels()
+
+    var first, current *tview.TreeNode
+    root.Walk(func(node, parent *tview.TreeNode) bool {
+        if node == root {
+            return true
+        }
+        if first == nil {
+            first = node
+        }
+        if node.GetReference().(*treeNode).path == currentPath {
+            current = node
+        }
+        return true
+    })
+    if current == nil {
+        current = first
+    }
+    fp.tree.SetCurrentNode(current)
+    fp.showPreview(current)
+}
+
+// Sort orders cycled through in the picker. Sorting by path keeps the
+// listing order, or the ranking while searching.
+var sortOrders = []string{"path", "size", "tokens"}
+
+// sortTree orders every directory's children largest first.
+func sortTree(n *treeNode, order string) {
+    if order == "path" {
+        return
+    }
+    sort.SliceStable(n.children, func(i, j int) bool {
+        a, b := n.children[i], n.children[j]
+        if order == "size" {
+            return a.size > b.size
+        }
+        return a.tokens > b.tokens
+    })
+    for _, child := range n.children {
+        sortTree(child, order)
+    }
+}
+
+type byScore struct {
+    files  []FileEntry
+    scores []int
+}
+
+func (b byScore) Len() int           { return len(b.files) }
+func (b byScore) Less(i, j int) bool { return b.scores[i] > b.scores[j] }
+func (b byScore) Swap(i, j int) {
+    b.files[i], b.files[j] = b.files[j], b.files[i]
+    b.scores[i], b.scores[j] = b.scores[j], b.scores[i]
+}
+
+// SetLoader sets how the picker reads and tokenizes files that were listed
+// without their content. Until Run starts loading them in the background,
+// such files show no token count.
+func (fp *FilePicker) SetLoader(load func(path string) (FileEntry, error)) {
+    fp.load = load
+}
+
+// SetSplitter sets how the picker tells selected files that do not exist
+// apart from those that exist but are not listed, so that loading a selection
+// can report them separately.
+func (fp *FilePicker) SetSplitter(split func(paths []string) (missing, excluded []string, err error)) {
+    fp.split = split
+}
 
-    search = strings.ToLower(search)
+type loadResult struct {
+    path  string
+    entry FileEntry
+    err   error
+}
+
+// startLoading loads the files listed without content on fp.threads workers.
+func (fp *FilePicker) startLoading() {
+    if fp.load == nil || len(fp.unloaded) == 0 {
+        return
+    }
+
+    var paths []string
     for _, file := range fp.files {
-        if search == "" || strings.Contains(strings.ToLower(file.Path), search) {
-            isSelected := false
-            for _, sel := range fp.selected {
-                if sel.Path == file.Path {
-                    isSelected = true
-                    break
+        if fp.unloaded[file.Path] {
+            paths = append(paths, file.Path)
+        }
+    }
+    fp.queue = newTokenQueue(paths)
+    fp.prioritize()
+
+    results := make(chan loadResult)
+    var wg sync.WaitGroup
+    for i := 0; i < fp.threads; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                path, ok := fp.queue.Pop()
+                if !ok {
+                    return
                 }
+                entry, err := fp.load(path)
+                results <- loadResult{path, entry, err}
             }
+        }()
+    }
+    go func() {
+        wg.Wait()
+        close(results)
+    }()
+    go fp.collectLoaded(results)
+}
 
-            fp.filtered = append(fp.filtered, file)
+const loadBatchInterval = 100 * time.Millisecond
+
+// collectLoaded hands loaded files to the UI in batches, as updating the
+// tree for every single file would be too slow in large repositories.
+func (fp *FilePicker) collectLoaded(results <-chan loadResult) {
+    ticker := time.NewTicker(loadBatchInterval)
+    defer ticker.Stop()
+
+    var batch []loadResult
+    flush := func() {
+        if len(batch) == 0 || fp.queue.Closed() {
+            return
+        }
+        loaded := batch
+        batch = nil
+        fp.app.QueueUpdateDraw(func() {
+            rebuild := false
+            var selected []string
+            for _, r := range loaded {
+                if fp.applyLoaded(r.path, r.entry, r.err) {
+                    rebuild = true
+                }
+                if fp.selected[r.path] {
+                    selected = append(selected, r.path)
+                }
+            }
+            dropped := fp.enforceBudget(selected)
+            fp.refreshLoaded(rebuild || dropped > 0 && fp.selectedOnly)
+            if dropped > 0 {
+                fp.updateStatus(fmt.Sprintf("%sDeselected %d files whose tokens took the selection over %d",
+                    fp.theme.Tag("error"), dropped, fp.limit))
+            }
+        })
+    }
 
-            prefix := "  "
-            if isSelected {
-                prefix = "✓ "
+    for {
+        select {
+        case r, ok := <-results:
+            if !ok {
+                flush()
+                return
             }
+            batch = append(batch, r)
+        case <-ticker.C:
+            flush()
+        }
+    }
+}
 
-            fp.list.AddItem(
-                prefix+file.Path,
-                formatFileInfo(file),
-                0,
-                nil,
-            )
+// applyLoaded stores a loaded file. It reports whether the tree has to be
+// rebuilt because the file turned out to be one that is skipped, such as a
+// binary file.
+func (fp *FilePicker) applyLoaded(path string, entry FileEntry, err error) bool {
+    if !fp.unloaded[path] {
+        return false
+    }
+    delete(fp.unloaded, path)
+
+    var skip *SkipError
+    switch {
+    case errors.As(err, &skip):
+        fp.skipped[path] = true
+        delete(fp.selected, path)
+        return true
+    case err != nil:
+        fp.failed[path] = err
+    default:
+        fp.files[fp.index[path]] = entry
+        for _, warning := range entry.Warnings {
+            fp.warnings = append(fp.warnings, fmt.Sprintf("%s: %s", path, warning))
         }
     }
+    return false
+}
 
-    if currentIndex >= 0 && currentIndex < fp.list.GetItemCount() {
-        fp.list.SetCurrentItem(currentIndex)
+// enforceBudget deselects the just loaded files in loaded, last first, for as
+// long as --strict-budget is set and they take the selection over the token
+// limit; setSelected had counted them as empty. It returns how many files
+// were deselected.
+func (fp *FilePicker) enforceBudget(loaded []string) int {
+    if !fp.strict || fp.limit <= 0 {
+        return 0
+    }
+    dropped := 0
+    for i := len(loaded) - 1; i >= 0 && fp.selectedTokens() > fp.limit; i-- {
+        delete(fp.selected, loaded[i])
+        dropped++
     }
+    return dropped
+}
+
+// refreshLoaded updates the tree, status and preview after files were
+// loaded, showing the first warning met while loading them.
+func (fp *FilePicker) refreshLoaded(rebuild bool) {
+    if len(fp.warnings) > 0 {
+        fp.message = fp.theme.Tag("warning") + tview.Escape(fp.warnings[0])
+        if len(fp.warnings) > 1 {
+            fp.message += fmt.Sprintf(" (and %d more)", len(fp.warnings)-1)
+        }
+        fp.warnings = nil
+    }
+    if rebuild || fp.searching || sortOrders[fp.sortOrder] == "tokens" {
+        fp.updateTree(fp.search.GetText())
+    } else {
+        fp.recount(fp.tree.GetRoot().GetReference().(*treeNode))
+        fp.refreshLabels()
+        fp.showPreview(fp.tree.GetCurrentNode())
+    }
+    fp.updateStatus(fp.message)
+}
+
+// recount updates the token totals of n and the directories under it.
+func (fp *FilePicker) recount(n *treeNode) int {
+    if !n.isDir {
+        n.tokens = fp.tokensOf(n.path)
+        return n.tokens
+    }
+    n.tokens = 0
+    for _, child := range n.children {
+        n.tokens += fp.recount(child)
+    }
+    return n.tokens
+}
+
+// prioritize has the highlighted files, then the selected ones, loaded
+// before the rest.
+func (fp *FilePicker) prioritize() {
+    if fp.queue == nil {
+        return
+    }
+
+    var paths []string
+    if node := fp.tree.GetCurrentNode(); node != nil {
+        for _, path := range descendantFiles(node.GetReference().(*treeNode)) {
+            if fp.unloaded[path] {
+                paths = append(paths, path)
+            }
+        }
+    }
+    for _, file := range fp.files {
+        if fp.selected[file.Path] && fp.unloaded[file.Path] {
+            paths = append(paths, file.Path)
+        }
+    }
+    fp.queue.Prioritize(paths)
+}
+
+const previewLines = 1000
+
+// showPreview shows the content of the highlighted file, or a placeholder
+// until it is loaded. Showing the same file again, as happens when token
+// counts come in, keeps the scroll position.
+func (fp *FilePicker) showPreview(node *tview.TreeNode) {
+    row, _ := fp.preview.GetScrollOffset()
+    fp.preview.Clear().ScrollToBeginning()
+    if node == nil {
+        fp.previewPath = ""
+        fp.preview.SetTitle("")
+        return
+    }
+    fp.prioritize()
+
+    n := node.GetReference().(*treeNode)
+    if n.path == fp.previewPath {
+        defer fp.preview.ScrollTo(row, 0)
+    }
+    fp.previewPath = n.path
+    if n.isDir {
+        fp.preview.SetTitle(" " + tview.Escape(n.path) + "/ ")
+        fp.preview.SetText(fmt.Sprintf("%d files, %d tokens", n.files, n.tokens))
+        return
+    }
+
+    file := fp.files[fp.index[n.path]]
+    if err := fp.failed[n.path]; err != nil {
+        fp.preview.SetTitle(" " + tview.Escape(n.path) + " ")
+        fp.preview.SetText(fp.theme.Tag("error") + tview.Escape(err.Error()))
+        return
+    }
+    if fp.unloaded[n.path] && fp.load != nil {
+        fp.preview.SetTitle(" " + tview.Escape(n.path) + " ")
+        fp.preview.SetText(fp.theme.Tag("muted") + "Loading...")
+        return
+    }
+
+    content := file.Content
+    if content == "" {
+        content = file.Diff
+    }
+    title := fmt.Sprintf(" %s, %d lines", tview.Escape(n.path), countLines(content))
+    if file.TokenCount != nil {
+        title += fmt.Sprintf(", %d tokens", file.TokenCount.Count)
+    }
+    fp.preview.SetTitle(title + " ")
+
+    lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+    more := ""
+    if len(lines) > previewLines {
+        more = fmt.Sprintf("\n%s... %d more lines", fp.theme.Tag("muted"), len(lines)-previewLines)
+        lines = lines[:previewLines]
+    }
+    fp.preview.SetText(highlightCode(strings.Join(lines, "\n"), file.Language, fp.theme) + more)
+}
+
+// buildNode mirrors a treeNode as tview nodes. While searching every
+// directory is expanded so that all matches are visible.
+func (fp *FilePicker) buildNode(n *treeNode, searching bool) *tview.TreeNode {
+    node := tview.NewTreeNode(n.name).SetReference(n).SetColor(fp.theme.Color("text"))
+    if n.isDir {
+        node.SetColor(fp.theme.Color("directory"))
+        node.SetExpanded(searching || !fp.collapsed[n.path])
+    }
+    node.SetSelectedTextStyle(tcell.StyleDefault.
+        Foreground(fp.theme.Color("highlight-text")).
+        Background(fp.theme.Color("highlight")))
+    for _, child := range n.children {
+        node.AddChild(fp.buildNode(child, searching))
+    }
+    return node
+}
+
+// refreshLabels redraws the checkmark and details of every node, showing
+// directories as fully (✓) or partially (◐) selected.
+func (fp *FilePicker) refreshLabels() {
+    fp.tree.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+        n := node.GetReference().(*treeNode)
+        paths := descendantFiles(n)
+        if len(paths) == 0 {
+            // The root of an empty tree
+            return true
+        }
+        count := 0
+        for _, path := range paths {
+            if fp.selected[path] {
+                count++
+            }
+        }
+
+        mark := "  "
+        if count == len(paths) && count > 0 {
+            mark = "✓ "
+        } else if count > 0 {
+            mark = "◐ "
+        }
+
+        var info string
+        if n.isDir {
+            info = fmt.Sprintf("%s/  (%d files", fp.highlightName(n, paths[0]), n.files)
+            if n.tokens > 0 {
+                info += fmt.Sprintf(", %d tokens", n.tokens)
+            }
+            info += ")"
+        } else {
+            info = fmt.Sprintf("%s  (%s)", fp.highlightName(n, n.path), formatFileInfo(fp.files[fp.index[n.path]]))
+        }
+        node.SetText(mark + info)
+        return true
+    })
+}
+
+// highlightName marks the characters of a node's name that the search
+// matched in file, which is the node itself or, for directories, the first
+// file under it.
+func (fp *FilePicker) highlightName(n *treeNode, file string) string {
+    positions := fp.matches[file]
+    if len(positions) == 0 {
+        return tview.Escape(n.name)
+    }
+
+    matched := make(map[int]bool, len(positions))
+    for _, pos := range positions {
+        matched[pos] = true
+    }
+
+    offset := utf8.RuneCountInString(n.path) - utf8.RuneCountInString(n.name)
+    var buf, plain strings.Builder
+    for i, r := range []rune(n.name) {
+        if !matched[offset+i] {
+            plain.WriteRune(r)
+            continue
+        }
+        buf.WriteString(tview.Escape(plain.String()))
+        plain.Reset()
+        buf.WriteString("[" + fp.theme["match"] + "::b]" + tview.Escape(string(r)) + "[-::-]")
+    }
+    buf.WriteString(tview.Escape(plain.String()))
+    return buf.String()
+}
+
+func descendantFiles(n *treeNode) []string {
+    if !n.isDir {
+        return []string{n.path}
+    }
+    var paths []string
+    for _, child := range n.children {
+        paths = append(paths, descendantFiles(child)...)
+    }
+    return paths
 }
 
 func formatFileInfo(file FileEntry) string {
@@ -177,6 +1138,9 @@ func formatFileInfo(file FileEntry) string {
     }
     
     info := fmt.Sprintf("%s, %s", size, ext)
+    if file.Generated != "" {
+        info += ", generated"
+    }
     
     if file.TokenCount != nil {
         tokenInfo := fmt.Sprintf(", %d tokens", file.TokenCount.Count)
@@ -202,6 +1166,35 @@ func formatSize(size int64) string {
     return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-func (fp *FilePicker) Run() error {
-    return fp.app.Run()
+// SetNotice shows a one-line message above the search box.
+func (fp *FilePicker) SetNotice(text string) {
+    fp.notice.SetText(text)
+}
+
+// SetScreen makes the picker draw to screen instead of the terminal, such as
+// a tcell.SimulationScreen when testing. It must be called before Run.
+func (fp *FilePicker) SetScreen(screen tcell.Screen) {
+    fp.app.SetScreen(screen)
+}
+
+func (fp *FilePicker) finish(selected []FileEntry, confirmed bool) {
+    fp.result = selected
+    fp.confirmed = confirmed
+    fp.app.Stop()
+}
+
+// Run shows the picker until the selection is confirmed or cancelled. It
+// returns the selected files in listing order, and false if cancelled.
+// Selected files may still lack their content if they had not been loaded
+// yet.
+func (fp *FilePicker) Run() ([]FileEntry, bool, error) {
+    fp.startLoading()
+    err := fp.app.Run()
+    if fp.queue != nil {
+        fp.queue.Close()
+    }
+    if err != nil {
+        return nil, false, err
+    }
+    return fp.result, fp.confirmed, nil
 }
\ No newline at end of file
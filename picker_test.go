@@ -0,0 +1,466 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// The tree of testFiles, as the picker first shows it:
+//
+//	cmd/
+//	└── run.go          10 tokens
+//	internal/
+//	├── a/
+//	│   ├── x.go        20 tokens
+//	│   └── y.go        30 tokens
+//	└── b.go            40 tokens
+//	main.go             50 tokens
+func testFiles() []FileEntry {
+    var files []FileEntry
+    for i, path := range []string{"cmd/run.go", "internal/a/x.go", "internal/a/y.go", "internal/b.go", "main.go"} {
+        files = append(files, FileEntry{
+            Path:       filepath.FromSlash(path),
+            Content:    "package main\n",
+            Size:       13,
+            Language:   "go",
+            TokenCount: &TokenCount{Count: (i + 1) * 10},
+        })
+    }
+    return files
+}
+
+func testConfig(t *testing.T) *Config {
+    return &Config{Path: t.TempDir(), TokenLimit: 1000}
+}
+
+// typed returns the keys for typing text.
+func typed(text string) []string {
+    var keys []string
+    for _, r := range text {
+        keys = append(keys, string(r))
+    }
+    return keys
+}
+
+// runPicker runs picker on a simulated screen, presses keys, which are named
+// as in key bindings, and returns the selected paths and whether the
+// selection was confirmed. keys must end by confirming or cancelling.
+func runPicker(t *testing.T, picker *FilePicker, keys ...string) ([]string, bool) {
+    t.Helper()
+
+    screen := tcell.NewSimulationScreen("UTF-8")
+    picker.SetScreen(screen)
+    screen.SetSize(120, 40)
+
+    type result struct {
+        files     []FileEntry
+        confirmed bool
+        err       error
+    }
+    done := make(chan result, 1)
+    go func() {
+        files, confirmed, err := picker.Run()
+        done <- result{files, confirmed, err}
+    }()
+
+    for _, key := range keys {
+        injectKey(t, screen, key)
+    }
+
+    select {
+    case r := <-done:
+        if r.err != nil {
+            t.Fatalf("Run failed: %v", r.err)
+        }
+        var paths []string
+        for _, file := range r.files {
+            paths = append(paths, filepath.ToSlash(file.Path))
+        }
+        return paths, r.confirmed
+    case <-time.After(5 * time.Second):
+        t.Fatalf("picker still running after keys %v", keys)
+        return nil, false
+    }
+}
+
+func injectKey(t *testing.T, screen tcell.SimulationScreen, name string) {
+    t.Helper()
+    switch {
+    case name == "Space":
+        screen.InjectKey(tcell.KeyRune, ' ', tcell.ModNone)
+        return
+    case len([]rune(name)) == 1:
+        screen.InjectKey(tcell.KeyRune, []rune(name)[0], tcell.ModNone)
+        return
+    }
+    for key, keyName := range tcell.KeyNames {
+        if keyName == name {
+            screen.InjectKey(key, 0, tcell.ModNone)
+            return
+        }
+    }
+    t.Fatalf("unknown key: %s", name)
+}
+
+// waitFor checks cond on the picker's event loop until it holds, failing the
+// test if it does not within a few seconds.
+func waitFor(t *testing.T, picker *FilePicker, cond func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        var ok bool
+        picker.app.QueueUpdate(func() { ok = cond() })
+        if ok {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("timed out waiting for the picker")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func TestPickerSelection(t *testing.T) {
+    tests := []struct {
+        name string
+        keys []string
+        want []string
+    }{
+        {"nothing", []string{"Enter"}, nil},
+        {"file", []string{"Down", "Space", "Enter"}, []string{"cmd/run.go"}},
+        {"directory", []string{"Down", "Down", "Space", "Enter"},
+            []string{"internal/a/x.go", "internal/a/y.go", "internal/b.go"}},
+        {"toggle twice", []string{"Space", "Space", "Enter"}, nil},
+        {"last file", []string{"End", "Space", "Enter"}, []string{"main.go"}},
+        {"collapsed directory", []string{"Down", "Down", "Left", "Down", "Space", "Enter"}, []string{"main.go"}},
+        {"parent directory", []string{"Down", "Down", "Down", "Down", "Left", "Space", "Enter"},
+            []string{"internal/a/x.go", "internal/a/y.go"}},
+        {"select all", []string{"a", "Enter"},
+            []string{"cmd/run.go", "internal/a/x.go", "internal/a/y.go", "internal/b.go", "main.go"}},
+        {"invert", []string{"End", "Space", "i", "Enter"},
+            []string{"cmd/run.go", "internal/a/x.go", "internal/a/y.go", "internal/b.go"}},
+        {"clear", []string{"a", "c", "Enter"}, nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            picker := NewFilePicker(testFiles(), testConfig(t))
+            got, confirmed := runPicker(t, picker, tt.keys...)
+            if !confirmed {
+                t.Fatal("selection not confirmed")
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("selected %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPickerCancel(t *testing.T) {
+    for _, key := range []string{"Esc", "Ctrl-C"} {
+        t.Run(key, func(t *testing.T) {
+            picker := NewFilePicker(testFiles(), testConfig(t))
+            got, confirmed := runPicker(t, picker, "a", key)
+            if confirmed || got != nil {
+                t.Errorf("got %v, confirmed %v; want nothing", got, confirmed)
+            }
+        })
+    }
+}
+
+func TestPickerSearch(t *testing.T) {
+    tests := []struct {
+        query string
+        want  []string
+    }{
+        {"xgo", []string{"internal/a/x.go"}},
+        {"dir:internal/a", []string{"internal/a/x.go", "internal/a/y.go"}},
+        {"tokens:>=40", []string{"internal/b.go", "main.go"}},
+        {"!internal", []string{"cmd/run.go", "main.go"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            picker := NewFilePicker(testFiles(), testConfig(t))
+            keys := append(append([]string{"/"}, typed(tt.query)...), "Enter", "a", "Enter")
+            got, _ := runPicker(t, picker, keys...)
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("selected %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPickerStrictBudget(t *testing.T) {
+    cfg := testConfig(t)
+    cfg.TokenLimit = 60
+    cfg.StrictBudget = true
+
+    // Selecting everything (150 tokens) is refused, the directory (90) too
+    picker := NewFilePicker(testFiles(), cfg)
+    got, _ := runPicker(t, picker, "a", "Down", "Down", "Space", "Up", "Space", "End", "Space", "Enter")
+    want := []string{"cmd/run.go", "main.go"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("selected %v, want %v", got, want)
+    }
+}
+
+func TestPickerSetSelection(t *testing.T) {
+    cfg := testConfig(t)
+    writeFiles(t, cfg.Path, map[string]string{"vendor/v.go": "package v\n"})
+    a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude)}
+
+    picker := NewFilePicker(testFiles(), cfg)
+    picker.SetSplitter(a.SplitUnlisted)
+    missing, excluded, err := picker.SetSelection([]string{"main.go", filepath.FromSlash("gone/old.go"), filepath.FromSlash("vendor/v.go")})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []string{filepath.FromSlash("gone/old.go")}; !reflect.DeepEqual(missing, want) {
+        t.Errorf("missing %v, want %v", missing, want)
+    }
+    if want := []string{filepath.FromSlash("vendor/v.go")}; !reflect.DeepEqual(excluded, want) {
+        t.Errorf("excluded %v, want %v", excluded, want)
+    }
+
+    // With only the selection shown, main.go is the one row left
+    got, _ := runPicker(t, picker, "v", "Down", "Space", "Enter")
+    if got != nil {
+        t.Errorf("selected %v, want nothing", got)
+    }
+}
+
+func TestPickerSaveSelection(t *testing.T) {
+    cfg := testConfig(t)
+    picker := NewFilePicker(testFiles(), cfg)
+    keys := append([]string{"End", "Space", "Ctrl-S"}, typed("api")...)
+    runPicker(t, picker, append(keys, "Enter", "Enter")...)
+
+    paths, err := LoadSelection(cfg.Path, "api")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []string{"main.go"}; !reflect.DeepEqual(paths, want) {
+        t.Errorf("saved %v, want %v", paths, want)
+    }
+
+    // Loading it back in a new picker
+    picker = NewFilePicker(testFiles(), cfg)
+    got, _ := runPicker(t, picker, "Ctrl-O", "Enter", "Enter")
+    if !reflect.DeepEqual(got, paths) {
+        t.Errorf("loaded %v, want %v", got, paths)
+    }
+}
+
+func TestPickerKeymap(t *testing.T) {
+    keymap, err := NewKeymap("vim", map[string][]string{"toggle": {"x"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := testConfig(t)
+    cfg.Keymap = keymap
+
+    picker := NewFilePicker(testFiles(), cfg)
+    got, _ := runPicker(t, picker, "G", "x", "g", "g", "j", "Space", "x", "Enter")
+    want := []string{"cmd/run.go", "main.go"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("selected %v, want %v", got, want)
+    }
+}
+
+func TestPickerLoadsInBackground(t *testing.T) {
+    files := testFiles()
+    var listed []FileEntry
+    for _, file := range files {
+        listed = append(listed, FileEntry{Path: file.Path, Size: file.Size})
+    }
+    listed = append(listed, FileEntry{Path: "image.png", Size: 100})
+
+    picker := NewFilePicker(listed, testConfig(t))
+    picker.SetLoader(func(path string) (FileEntry, error) {
+        if strings.HasSuffix(path, ".png") {
+            return FileEntry{}, &SkipError{Kind: "binary", Reason: "image"}
+        }
+        for _, file := range files {
+            if file.Path == path {
+                if path == "main.go" {
+                    file.Warnings = []string{"not valid UTF-8, decoded as windows-1252"}
+                }
+                return file, nil
+            }
+        }
+        t.Errorf("unexpected load of %s", path)
+        return FileEntry{}, nil
+    })
+
+    screen := tcell.NewSimulationScreen("UTF-8")
+    picker.SetScreen(screen)
+    done := make(chan []FileEntry, 1)
+    go func() {
+        selected, _, _ := picker.Run()
+        done <- selected
+    }()
+
+    // Wait for the picker to take in every loaded file before selecting
+    waitFor(t, picker, func() bool { return len(picker.unloaded) == 0 })
+
+    // Warnings go to the status bar rather than the terminal tview draws on
+    var status string
+    picker.app.QueueUpdate(func() { status = picker.status.GetText(true) })
+    if !strings.Contains(status, "main.go: not valid UTF-8") {
+        t.Errorf("status %q does not show the warning", status)
+    }
+
+    injectKey(t, screen, "a")
+    injectKey(t, screen, "Enter")
+
+    selected := <-done
+    if len(selected) != len(files) {
+        t.Fatalf("selected %d files, want %d without the skipped one", len(selected), len(files))
+    }
+    for i, file := range selected {
+        if file.TokenCount == nil || file.TokenCount.Count != files[i].TokenCount.Count {
+            t.Errorf("%s: token count not loaded", file.Path)
+        }
+    }
+}
+
+func TestPickerKeepsMessageUntilNextKey(t *testing.T) {
+    cfg := testConfig(t)
+    cfg.TokenLimit = 60
+    cfg.StrictBudget = true
+
+    // The image is skipped once loaded, which rebuilds the tree
+    release := make(chan struct{})
+    picker := NewFilePicker(append(testFiles(), FileEntry{Path: "image.png", Size: 100}), cfg)
+    picker.SetLoader(func(path string) (FileEntry, error) {
+        <-release
+        return FileEntry{}, &SkipError{Kind: "binary", Reason: "image"}
+    })
+
+    screen := tcell.NewSimulationScreen("UTF-8")
+    picker.SetScreen(screen)
+    screen.SetSize(120, 40)
+    done := make(chan struct{})
+    go func() {
+        picker.Run()
+        close(done)
+    }()
+
+    status := func() string { return picker.status.GetText(true) }
+
+    injectKey(t, screen, "a")
+    waitFor(t, picker, func() bool { return strings.Contains(status(), "Not selected") })
+
+    close(release)
+    waitFor(t, picker, func() bool { return len(picker.unloaded) == 0 })
+    var text string
+    picker.app.QueueUpdate(func() { text = status() })
+    if !strings.Contains(text, "Not selected") {
+        t.Errorf("message cleared by loading: %q", text)
+    }
+
+    injectKey(t, screen, "Down")
+    waitFor(t, picker, func() bool { return !strings.Contains(status(), "Not selected") })
+
+    injectKey(t, screen, "Esc")
+    <-done
+}
+
+func TestPickerContentSearchWhileLoading(t *testing.T) {
+    var listed []FileEntry
+    for _, file := range testFiles() {
+        listed = append(listed, FileEntry{Path: file.Path, Size: file.Size})
+    }
+
+    // Loading waits until released, so a search that waited for it would
+    // hang the picker
+    release := make(chan struct{})
+    picker := NewFilePicker(listed, testConfig(t))
+    picker.SetLoader(func(path string) (FileEntry, error) {
+        <-release
+        content := "package main\n"
+        if filepath.Base(path) == "y.go" {
+            content += "func needle() {}\n"
+        }
+        return FileEntry{Path: path, Content: content, TokenCount: &TokenCount{Count: 1}}, nil
+    })
+
+    screen := tcell.NewSimulationScreen("UTF-8")
+    picker.SetScreen(screen)
+    screen.SetSize(120, 40)
+    done := make(chan []FileEntry, 1)
+    go func() {
+        selected, _, _ := picker.Run()
+        done <- selected
+    }()
+
+    for _, key := range append([]string{"/"}, typed("/needle/")...) {
+        injectKey(t, screen, key)
+    }
+    waitFor(t, picker, func() bool { return len(picker.filtered) == 0 })
+
+    close(release)
+    waitFor(t, picker, func() bool { return len(picker.filtered) == 1 })
+
+    for _, key := range []string{"Enter", "a", "Enter"} {
+        injectKey(t, screen, key)
+    }
+    selected := <-done
+    if len(selected) != 1 || filepath.ToSlash(selected[0].Path) != "internal/a/y.go" {
+        t.Errorf("selected %v, want internal/a/y.go", selected)
+    }
+}
+
+func TestPickerStrictBudgetWhileLoading(t *testing.T) {
+    cfg := testConfig(t)
+    cfg.TokenLimit = 60
+    cfg.StrictBudget = true
+
+    files := testFiles()
+    byPath := make(map[string]FileEntry)
+    var listed []FileEntry
+    for _, file := range files {
+        byPath[file.Path] = file
+        listed = append(listed, FileEntry{Path: file.Path, Size: file.Size})
+    }
+
+    // Everything is selected while the counts are unknown, and the 150
+    // tokens only come in afterwards
+    release := make(chan struct{})
+    picker := NewFilePicker(listed, cfg)
+    picker.SetLoader(func(path string) (FileEntry, error) {
+        <-release
+        return byPath[path], nil
+    })
+
+    screen := tcell.NewSimulationScreen("UTF-8")
+    picker.SetScreen(screen)
+    screen.SetSize(120, 40)
+    done := make(chan []FileEntry, 1)
+    go func() {
+        selected, _, _ := picker.Run()
+        done <- selected
+    }()
+
+    injectKey(t, screen, "a")
+    waitFor(t, picker, func() bool { return len(picker.selected) == len(files) })
+    close(release)
+
+    waitFor(t, picker, func() bool { return len(picker.unloaded) == 0 })
+    injectKey(t, screen, "Enter")
+
+    tokens := 0
+    selected := <-done
+    for _, file := range selected {
+        tokens += file.TokenCount.Count
+    }
+    if len(selected) == 0 || tokens > cfg.TokenLimit {
+        t.Errorf("selected %d files with %d tokens, want some within the limit of %d", len(selected), tokens, cfg.TokenLimit)
+    }
+}
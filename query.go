@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// searchTerm is one space-separated part of a picker search. Plain terms are
+// fuzzy-matched against the path; the rest filter without affecting ranking.
+type searchTerm struct {
+    negate  bool
+    fuzzy   string
+    exts    []string
+    dir     string
+    tokenOp string
+    tokens  int
+    content *regexp.Regexp
+}
+
+type searchQuery struct {
+    terms []searchTerm
+}
+
+var tokenFilterRe = regexp.MustCompile(`^(>=|<=|>|<|=)?(\d+)$`)
+
+// parseQuery parses a picker search such as "hand ext:go dir:internal
+// tokens:>2000 !test /func \w+Handler/". Prefixing any term with ! inverts it.
+func parseQuery(text string) (*searchQuery, error) {
+    query := &searchQuery{}
+
+    for _, field := range splitQuery(text) {
+        var term searchTerm
+        if strings.HasPrefix(field, "!") && len(field) > 1 {
+            term.negate = true
+            field = field[1:]
+        }
+
+        key, value, hasKey := strings.Cut(field, ":")
+        switch {
+        case len(field) > 2 && strings.HasPrefix(field, "/") && strings.HasSuffix(field, "/"):
+            re, err := regexp.Compile(field[1 : len(field)-1])
+            if err != nil {
+                return nil, fmt.Errorf("invalid content search %s: %w", field, err)
+            }
+            term.content = re
+
+        case hasKey && key == "ext" && value != "":
+            for _, ext := range strings.Split(value, ",") {
+                term.exts = append(term.exts, "."+strings.ToLower(strings.TrimPrefix(ext, ".")))
+            }
+
+        case hasKey && key == "dir" && value != "":
+            term.dir = strings.ToLower(strings.Trim(filepath.ToSlash(value), "/"))
+
+        case hasKey && key == "tokens":
+            m := tokenFilterRe.FindStringSubmatch(value)
+            if m == nil {
+                return nil, fmt.Errorf("invalid token filter %s, expected e.g. tokens:>2000", field)
+            }
+            term.tokenOp = m[1]
+            if term.tokenOp == "" {
+                term.tokenOp = "="
+            }
+            term.tokens, _ = strconv.Atoi(m[2])
+
+        default:
+            term.fuzzy = field
+        }
+        query.terms = append(query.terms, term)
+    }
+
+    return query, nil
+}
+
+// splitQuery splits on spaces, except inside a /regex/.
+func splitQuery(text string) []string {
+    var fields []string
+    var current strings.Builder
+    inRegex := false
+
+    for i := 0; i < len(text); i++ {
+        c := text[i]
+        switch {
+        case c == '/' && !inRegex && (current.Len() == 0 || current.String() == "!"):
+            inRegex = true
+        case c == '/' && inRegex && text[i-1] != '\\':
+            inRegex = false
+        case c == ' ' && !inRegex:
+            if current.Len() > 0 {
+                fields = append(fields, current.String())
+                current.Reset()
+            }
+            continue
+        }
+        current.WriteByte(c)
+    }
+    if current.Len() > 0 {
+        fields = append(fields, current.String())
+    }
+    return fields
+}
+
+// needsContent reports whether the query searches file bodies.
+func (q *searchQuery) needsContent() bool {
+    for _, term := range q.terms {
+        if term.content != nil {
+            return true
+        }
+    }
+    return false
+}
+
+// match reports whether file satisfies every term, returning its fuzzy score
+// and the rune positions in its path that were matched.
+func (q *searchQuery) match(file FileEntry) (bool, int, []int) {
+    path := filepath.ToSlash(file.Path)
+    score := 0
+    var positions []int
+
+    for _, term := range q.terms {
+        var ok bool
+        switch {
+        case term.content != nil:
+            ok = term.content.MatchString(file.Content)
+
+        case term.exts != nil:
+            ext := strings.ToLower(filepath.Ext(path))
+            for _, want := range term.exts {
+                ok = ok || ext == want
+            }
+
+        case term.dir != "":
+            dir := strings.ToLower(filepath.ToSlash(filepath.Dir(path))) + "/"
+            ok = strings.HasPrefix(dir, term.dir+"/") || strings.Contains(dir, "/"+term.dir+"/")
+
+        case term.tokenOp != "":
+            tokens := 0
+            if file.TokenCount != nil {
+                tokens = file.TokenCount.Count
+            }
+            switch term.tokenOp {
+            case ">":
+                ok = tokens > term.tokens
+            case ">=":
+                ok = tokens >= term.tokens
+            case "<":
+                ok = tokens < term.tokens
+            case "<=":
+                ok = tokens <= term.tokens
+            default:
+                ok = tokens == term.tokens
+            }
+
+        case term.negate:
+            // Like fzf, a negated term is an exact substring match
+            ok = strings.Contains(strings.ToLower(path), strings.ToLower(term.fuzzy))
+
+        default:
+            s, pos, matched := fuzzyMatch(term.fuzzy, path)
+            ok = matched
+            score += s
+            positions = append(positions, pos...)
+        }
+
+        if ok == term.negate {
+            return false, 0, nil
+        }
+    }
+
+    return true, score, positions
+}
+
+const (
+    scoreMatch       = 16
+    bonusSegment     = 10
+    bonusBoundary    = 8
+    bonusCamel       = 7
+    bonusConsecutive = 8
+    penaltyGapStart  = 3
+    penaltyGap       = 1
+)
+
+// fuzzyMatch finds pattern's characters in order within text, the way fzf's
+// v1 algorithm does: a forward scan finds where the match ends, and a
+// backward scan from there finds the shortest window that still matches.
+// Matching is case-insensitive unless pattern contains an uppercase letter.
+func fuzzyMatch(pattern, text string) (int, []int, bool) {
+    p := []rune(pattern)
+    t := []rune(text)
+    if len(p) == 0 {
+        return 0, nil, true
+    }
+
+    caseSensitive := false
+    for _, r := range p {
+        if unicode.IsUpper(r) {
+            caseSensitive = true
+            break
+        }
+    }
+    equal := func(a, b rune) bool {
+        if caseSensitive {
+            return a == b
+        }
+        return unicode.ToLower(a) == unicode.ToLower(b)
+    }
+
+    pi, end := 0, -1
+    for ti := 0; ti < len(t); ti++ {
+        if equal(t[ti], p[pi]) {
+            pi++
+            if pi == len(p) {
+                end = ti
+                break
+            }
+        }
+    }
+    if end < 0 {
+        return 0, nil, false
+    }
+
+    start := end
+    for pi = len(p) - 1; start >= 0; start-- {
+        if equal(t[start], p[pi]) {
+            pi--
+            if pi < 0 {
+                break
+            }
+        }
+    }
+
+    score := 0
+    var positions []int
+    pi = 0
+    prev := -1
+    for ti := start; ti <= end && pi < len(p); ti++ {
+        if !equal(t[ti], p[pi]) {
+            continue
+        }
+        score += scoreMatch + charBonus(t, ti)
+        if prev >= 0 {
+            if gap := ti - prev - 1; gap == 0 {
+                score += bonusConsecutive
+            } else {
+                score -= penaltyGapStart + (gap-1)*penaltyGap
+            }
+        }
+        positions = append(positions, ti)
+        prev = ti
+        pi++
+    }
+
+    return score, positions, true
+}
+
+// charBonus rewards matches that start a path segment or a word.
+func charBonus(t []rune, i int) int {
+    if i == 0 || t[i-1] == '/' {
+        return bonusSegment
+    }
+    switch prev := t[i-1]; {
+    case prev == '_' || prev == '-' || prev == '.' || prev == ' ':
+        return bonusBoundary
+    case unicode.IsLower(prev) && unicode.IsUpper(t[i]):
+        return bonusCamel
+    }
+    return 0
+}
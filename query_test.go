@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+    tests := []struct {
+        text    string
+        want    []searchTerm
+        wantErr bool
+    }{
+        {"", nil, false},
+        {"  hand  ", []searchTerm{{fuzzy: "hand"}}, false},
+        {"ext:go,.TS", []searchTerm{{exts: []string{".go", ".ts"}}}, false},
+        {"dir:/internal/api/", []searchTerm{{dir: "internal/api"}}, false},
+        {"tokens:>2000", []searchTerm{{tokenOp: ">", tokens: 2000}}, false},
+        {"tokens:500", []searchTerm{{tokenOp: "=", tokens: 500}}, false},
+        {"tokens:lots", nil, true},
+        {"!test", []searchTerm{{negate: true, fuzzy: "test"}}, false},
+        {"!", []searchTerm{{fuzzy: "!"}}, false},
+        {"ext:", []searchTerm{{fuzzy: "ext:"}}, false},
+        {"/func \\w+Handler/ !/TODO/", []searchTerm{{content: regexp.MustCompile(`func \w+Handler`)}, {negate: true, content: regexp.MustCompile("TODO")}}, false},
+        {"/a\\/b c/", []searchTerm{{content: regexp.MustCompile(`a\/b c`)}}, false},
+        {"/(/", nil, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.text, func(t *testing.T) {
+            query, err := parseQuery(tt.text)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("parseQuery(%q) error = %v, want error %v", tt.text, err, tt.wantErr)
+            }
+            if err != nil {
+                return
+            }
+            if !reflect.DeepEqual(query.terms, tt.want) {
+                t.Errorf("parseQuery(%q) = %+v, want %+v", tt.text, query.terms, tt.want)
+            }
+        })
+    }
+}
+
+func TestQueryMatch(t *testing.T) {
+    file := FileEntry{
+        Path:       "internal/api/handler.go",
+        Content:    "func UserHandler() {}\n",
+        TokenCount: &TokenCount{Count: 2500},
+    }
+
+    tests := []struct {
+        text string
+        want bool
+    }{
+        {"hand", true},
+        {"hnd ext:go", true},
+        {"ext:ts", false},
+        {"dir:api", true},
+        {"dir:pi", false},
+        {"tokens:>2000 tokens:<3000", true},
+        {"tokens:<=2000", false},
+        {"!test", true},
+        {"!handler", false},
+        {"/func \\w+Handler/", true},
+        {"!/func/", false},
+        {"xyz", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.text, func(t *testing.T) {
+            query, err := parseQuery(tt.text)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got, _, _ := query.match(file); got != tt.want {
+                t.Errorf("%q matched %v, want %v", tt.text, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestFuzzyMatch(t *testing.T) {
+    tests := []struct {
+        pattern   string
+        text      string
+        ok        bool
+        positions []int
+    }{
+        {"", "main.go", true, nil},
+        {"mgo", "main.go", true, []int{0, 5, 6}},
+        {"MAIN", "main.go", false, nil},
+        {"Main", "cmd/Main.go", true, []int{4, 5, 6, 7}},
+        {"og", "main.go", false, nil},
+        // The backward scan narrows the match to the shortest window
+        {"ab", "a_xab", true, []int{3, 4}},
+        {"日本", "docs/日本語.md", true, []int{5, 6}},
+    }
+
+    for _, tt := range tests {
+        _, positions, ok := fuzzyMatch(tt.pattern, tt.text)
+        if ok != tt.ok || !reflect.DeepEqual(positions, tt.positions) {
+            t.Errorf("fuzzyMatch(%q, %q) = %v, %v; want %v, %v", tt.pattern, tt.text, positions, ok, tt.positions, tt.ok)
+        }
+    }
+
+    // Matches at segment starts, word boundaries and in a row rank higher
+    better := []struct{ pattern, better, worse string }{
+        {"han", "api/handler.go", "api/chan.go"},
+        {"uh", "user_handler.go", "fuchsia.go"},
+        {"uh", "userHandler.go", "auhx.go"},
+        {"main", "main.go", "m_a_i_n.go"},
+    }
+    for _, tt := range better {
+        b, _, _ := fuzzyMatch(tt.pattern, tt.better)
+        w, _, _ := fuzzyMatch(tt.pattern, tt.worse)
+        if b <= w {
+            t.Errorf("fuzzyMatch(%q): %q scored %d, not above %q at %d", tt.pattern, tt.better, b, tt.worse, w)
+        }
+    }
+}
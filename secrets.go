@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type SecretFinding struct {
+    Rule   string
+    Line   int
+    InDiff bool // Line counts from the start of the diff, not the file
+}
+
+// location formats where the finding is for the summary and errors.
+func (f SecretFinding) location(path string) string {
+    if f.InDiff {
+        return fmt.Sprintf("%s (diff line %d)", path, f.Line)
+    }
+    return fmt.Sprintf("%s:%d", path, f.Line)
+}
+
+// secretRule matches a credential. When group is non-zero only that submatch
+// is the secret, so the surrounding key name stays readable after redaction.
+type secretRule struct {
+    name  string
+    re    *regexp.Regexp
+    group int
+}
+
+var secretRules = []secretRule{
+    {"private-key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----`), 0},
+    {"aws-access-key-id", regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`), 0},
+    {"aws-secret-access-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), 1},
+    {"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`), 0},
+    {"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`), 0},
+    {"stripe-key", regexp.MustCompile(`\b[sr]k_(?:live|test)_[A-Za-z0-9]{16,}\b`), 0},
+    {"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), 0},
+    {"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), 0},
+    {"url-credentials", regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@"']+:([^/\s:@"']{3,})@`), 1},
+    {"password", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret)["']?\s*[:=]\s*["']([^"'\s]{4,})["']`), 1},
+    {"password", regexp.MustCompile(`(?m)^\s*(?:export\s+)?[A-Z0-9_]*(?:PASSWORD|PASSWD|SECRET|TOKEN|API_KEY)[A-Z0-9_]*\s*=\s*["']?([^\s"'#]{4,})`), 1},
+}
+
+var highEntropyRe = regexp.MustCompile(`["'\x60]([A-Za-z0-9+/=_-]{24,})["'\x60]`)
+
+// scanSecrets finds credentials in content and replaces each with a
+// [REDACTED:<rule>] placeholder.
+func scanSecrets(content string) (string, []SecretFinding) {
+    type match struct {
+        start, end int
+        rule       string
+    }
+    var matches []match
+
+    for _, rule := range secretRules {
+        for _, loc := range rule.re.FindAllStringSubmatchIndex(content, -1) {
+            start, end := loc[2*rule.group], loc[2*rule.group+1]
+            if start >= 0 {
+                matches = append(matches, match{start, end, rule.name})
+            }
+        }
+    }
+
+    for _, loc := range highEntropyRe.FindAllStringSubmatchIndex(content, -1) {
+        candidate := content[loc[2]:loc[3]]
+        if looksRandom(candidate) {
+            matches = append(matches, match{loc[2], loc[3], "high-entropy-string"})
+        }
+    }
+
+    if len(matches) == 0 {
+        return content, nil
+    }
+
+    // Earlier rules are more specific, so on overlap keep the first match
+    sort.SliceStable(matches, func(i, j int) bool {
+        return matches[i].start < matches[j].start
+    })
+
+    var buf strings.Builder
+    var findings []SecretFinding
+    last := 0
+    for _, m := range matches {
+        if m.start < last {
+            continue
+        }
+        buf.WriteString(content[last:m.start])
+        fmt.Fprintf(&buf, "[REDACTED:%s]", m.rule)
+        findings = append(findings, SecretFinding{
+            Rule: m.rule,
+            Line: strings.Count(content[:m.start], "\n") + 1,
+        })
+        last = m.end
+    }
+    buf.WriteString(content[last:])
+
+    return buf.String(), findings
+}
+
+// looksRandom reports whether s has the character mix and entropy of a key
+// or token rather than an identifier, path or word.
+func looksRandom(s string) bool {
+    var upper, lower, digit bool
+    for _, c := range s {
+        switch {
+        case c >= 'A' && c <= 'Z':
+            upper = true
+        case c >= 'a' && c <= 'z':
+            lower = true
+        case c >= '0' && c <= '9':
+            digit = true
+        }
+    }
+    if !digit || !(upper || lower) {
+        return false
+    }
+
+    threshold := 4.2
+    if isHex(s) {
+        threshold = 3.5
+    }
+    return shannonEntropy(s) > threshold
+}
+
+func isHex(s string) bool {
+    for _, c := range s {
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+            return false
+        }
+    }
+    return true
+}
+
+func shannonEntropy(s string) float64 {
+    counts := make(map[rune]int)
+    for _, c := range s {
+        counts[c]++
+    }
+
+    var entropy float64
+    n := float64(len(s))
+    for _, count := range counts {
+        p := float64(count) / n
+        entropy -= p * math.Log2(p)
+    }
+    return entropy
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Selection sets are saved picker selections, stored one path per line in
+// .peeker/selections/<name>.txt under the analyzed directory.
+
+const selectionDir = ".peeker/selections"
+
+func selectionFile(root, name string) (string, error) {
+    if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+        return "", fmt.Errorf("invalid selection name '%s'", name)
+    }
+    return filepath.Join(root, filepath.FromSlash(selectionDir), name+".txt"), nil
+}
+
+func SaveSelection(root, name string, paths []string) error {
+    file, err := selectionFile(root, name)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+        return fmt.Errorf("failed to create selection directory: %w", err)
+    }
+
+    var buf strings.Builder
+    for _, path := range paths {
+        buf.WriteString(filepath.ToSlash(path) + "\n")
+    }
+    if err := os.WriteFile(file, []byte(buf.String()), 0644); err != nil {
+        return fmt.Errorf("failed to save selection '%s': %w", name, err)
+    }
+    return nil
+}
+
+// LoadSelection returns the paths in a selection set. Blank lines and lines
+// starting with # are ignored. Sets are often committed, so paths leading
+// outside the analyzed directory are refused.
+func LoadSelection(root, name string) ([]string, error) {
+    file, err := selectionFile(root, name)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(file)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, fmt.Errorf("no selection named '%s'", name)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to load selection '%s': %w", name, err)
+    }
+    defer f.Close()
+
+    var paths []string
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        path := filepath.FromSlash(line)
+        if !filepath.IsLocal(path) {
+            return nil, fmt.Errorf("selection '%s' has a path outside the analyzed directory: %s", name, line)
+        }
+        paths = append(paths, filepath.Clean(path))
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to load selection '%s': %w", name, err)
+    }
+    return paths, nil
+}
+
+// ListSelections returns the names of the saved selection sets.
+func ListSelections(root string) ([]string, error) {
+    entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(selectionDir)))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to list selections: %w", err)
+    }
+
+    var names []string
+    for _, entry := range entries {
+        if name, ok := strings.CutSuffix(entry.Name(), ".txt"); ok && !entry.IsDir() {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    return names, nil
+}
+
+// SplitUnlisted sorts selected paths that are not among the listed files into
+// those that do not exist, at --git-ref if one is given, and those that exist
+// but were excluded by the filters.
+func (a *Analyzer) SplitUnlisted(paths []string) (missing, excluded []string, err error) {
+    var atRef map[string]bool
+    if a.config.GitRef != "" && len(paths) > 0 {
+        files, err := a.git.FilesAt(a.config.GitRef)
+        if err != nil {
+            return nil, nil, err
+        }
+        atRef = make(map[string]bool, len(files))
+        for _, f := range files {
+            atRef[filepath.FromSlash(f.Path)] = true
+        }
+    }
+
+    for _, path := range paths {
+        exists := atRef[path]
+        if atRef == nil {
+            info, err := os.Stat(filepath.Join(a.config.Path, path))
+            exists = err == nil && !info.IsDir()
+        }
+        if exists {
+            excluded = append(excluded, path)
+        } else {
+            missing = append(missing, path)
+        }
+    }
+    return missing, excluded, nil
+}
+
+// CollectSelection processes the files of a selection set, applying the same
+// filters as to any other file. Files that no longer exist are returned
+// separately so that they can be reported.
+func (a *Analyzer) CollectSelection(paths []string) ([]FileEntry, []string, error) {
+    a.selection = make(map[string]bool, len(paths))
+    for _, path := range paths {
+        a.selection[path] = true
+    }
+
+    candidates, err := a.ListFiles()
+    if err != nil {
+        return nil, nil, err
+    }
+    listed := make(map[string]bool, len(candidates))
+    for _, candidate := range candidates {
+        listed[candidate.Path] = true
+    }
+    var unlisted []string
+    for _, path := range paths {
+        if !listed[path] {
+            unlisted = append(unlisted, path)
+        }
+    }
+
+    missing, excluded, err := a.SplitUnlisted(unlisted)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(excluded) > 0 {
+        fmt.Fprintf(os.Stderr, "Warning: skipped %d files in the selection that the current filters exclude: %s\n",
+            len(excluded), strings.Join(excluded, ", "))
+    }
+
+    return a.collect(candidates), missing, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+    t.Helper()
+    for path, content := range files {
+        path = filepath.Join(root, filepath.FromSlash(path))
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func TestLoadSelectionRejectsOutsidePaths(t *testing.T) {
+    root := t.TempDir()
+    for _, path := range []string{"../secret.txt", "a/../../secret.txt", "/etc/passwd"} {
+        writeFiles(t, root, map[string]string{".peeker/selections/bad.txt": "main.go\n" + path + "\n"})
+        if _, err := LoadSelection(root, "bad"); err == nil || !strings.Contains(err.Error(), "outside") {
+            t.Errorf("%s: got error %v, want a path outside the analyzed directory", path, err)
+        }
+    }
+
+    writeFiles(t, root, map[string]string{".peeker/selections/ok.txt": "# API\n./cmd/run.go\n\na/../main.go\n"})
+    paths, err := LoadSelection(root, "ok")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []string{filepath.FromSlash("cmd/run.go"), "main.go"}; !reflect.DeepEqual(paths, want) {
+        t.Errorf("loaded %v, want %v", paths, want)
+    }
+}
+
+func TestCollectSelection(t *testing.T) {
+    root := t.TempDir()
+    writeFiles(t, root, map[string]string{
+        "main.go":       "package main\n",
+        "cmd/run.go":    "package cmd\n",
+        "big.go":        strings.Repeat("x", 100),
+        ".env":          "TOKEN=1\n",
+        "vendor/v.go":   "package v\n",
+        "unselected.go": "package main\n",
+    })
+
+    cfg := &Config{Path: root, MaxSize: 50, MaxDepth: 20, Exclude: []string{"vendor"}}
+    a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude)}
+
+    selection := []string{"main.go", filepath.FromSlash("cmd/run.go"), "big.go", ".env", filepath.FromSlash("vendor/v.go"), "gone.go"}
+    entries, missing, err := a.CollectSelection(selection)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var paths []string
+    for _, entry := range entries {
+        paths = append(paths, filepath.ToSlash(entry.Path))
+    }
+    if want := []string{"cmd/run.go", "main.go"}; !reflect.DeepEqual(paths, want) {
+        t.Errorf("collected %v, want %v", paths, want)
+    }
+    if want := []string{"gone.go"}; !reflect.DeepEqual(missing, want) {
+        t.Errorf("missing %v, want %v", missing, want)
+    }
+
+    // Later listings, as when watching, stay within the selection
+    listed, err := a.ListFiles()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(listed) != 2 {
+        t.Errorf("listed %v, want only the selected files", listed)
+    }
+}
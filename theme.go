@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Theme maps the picker's color roles to tcell color names or #rrggbb values.
+type Theme map[string]string
+
+var themes = map[string]Theme{
+    "dark": {
+        "background":     "black",
+        "text":           "white",
+        "muted":          "gray",
+        "border":         "white",
+        "directory":      "steelblue",
+        "highlight":      "royalblue",
+        "highlight-text": "white",
+        "input":          "blue",
+        "match":          "orange",
+        "comment":        "gray",
+        "string":         "green",
+        "keyword":        "yellow",
+        "ok":             "green",
+        "warning":        "yellow",
+        "error":          "red",
+    },
+    "light": {
+        "background":     "white",
+        "text":           "black",
+        "muted":          "gray",
+        "border":         "black",
+        "directory":      "navy",
+        "highlight":      "lightskyblue",
+        "highlight-text": "black",
+        "input":          "lightgray",
+        "match":          "darkorange",
+        "comment":        "gray",
+        "string":         "darkgreen",
+        "keyword":        "purple",
+        "ok":             "darkgreen",
+        "warning":        "darkgoldenrod",
+        "error":          "red",
+    },
+}
+
+func NewTheme(name string, overrides map[string]string) (Theme, error) {
+    if name == "" {
+        name = "dark"
+    }
+    base, ok := themes[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown theme: %s", name)
+    }
+
+    theme := make(Theme, len(base))
+    for role, color := range base {
+        theme[role] = color
+    }
+    for role, color := range overrides {
+        if _, ok := base[role]; !ok {
+            return nil, fmt.Errorf("unknown color role: %s", role)
+        }
+        if color != "default" && tcell.GetColor(color) == tcell.ColorDefault {
+            return nil, fmt.Errorf("invalid color for %s: %s", role, color)
+        }
+        theme[role] = strings.ToLower(color)
+    }
+    return theme, nil
+}
+
+func (t Theme) Color(role string) tcell.Color {
+    return tcell.GetColor(t[role])
+}
+
+// Tag returns a tview color tag for role.
+func (t Theme) Tag(role string) string {
+    return "[" + t[role] + "]"
+}
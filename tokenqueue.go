@@ -0,0 +1,66 @@
+package main
+
+import "sync"
+
+// tokenQueue hands out the files the picker still has to read and tokenize.
+// Files the user is looking at go first, then the rest in listing order.
+type tokenQueue struct {
+    mu     sync.Mutex
+    paths  []string
+    next   int
+    urgent []string
+    taken  map[string]bool
+    closed bool
+}
+
+func newTokenQueue(paths []string) *tokenQueue {
+    return &tokenQueue{paths: paths, taken: make(map[string]bool, len(paths))}
+}
+
+// Prioritize makes paths the next ones handed out, replacing any given
+// before.
+func (q *tokenQueue) Prioritize(paths []string) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.urgent = paths
+}
+
+// Pop returns the next file to load, or false once every file has been
+// handed out or the queue is closed.
+func (q *tokenQueue) Pop() (string, bool) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    if q.closed {
+        return "", false
+    }
+
+    for len(q.urgent) > 0 {
+        path := q.urgent[0]
+        q.urgent = q.urgent[1:]
+        if !q.taken[path] {
+            q.taken[path] = true
+            return path, true
+        }
+    }
+    for q.next < len(q.paths) {
+        path := q.paths[q.next]
+        q.next++
+        if !q.taken[path] {
+            q.taken[path] = true
+            return path, true
+        }
+    }
+    return "", false
+}
+
+func (q *tokenQueue) Close() {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.closed = true
+}
+
+func (q *tokenQueue) Closed() bool {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    return q.closed
+}
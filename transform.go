@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ContentTransform rewrites file content before it is tokenized and printed.
+// Transforms are opt-in and run in the order given to --transform.
+type ContentTransform interface {
+    Name() string
+    Apply(content, language string) string
+}
+
+type transformFunc struct {
+    name  string
+    apply func(content, language string) string
+}
+
+func (t transformFunc) Name() string {
+    return t.name
+}
+
+func (t transformFunc) Apply(content, language string) string {
+    return t.apply(content, language)
+}
+
+var transforms = make(map[string]ContentTransform)
+
+// linePreserving lists the transforms that only edit lines in place, so
+// --line-numbers still matches the source after them.
+var linePreserving = map[string]bool{
+    "trim-trailing":  true,
+    "tabs-to-spaces": true,
+}
+
+func RegisterTransform(t ContentTransform) {
+    transforms[t.Name()] = t
+}
+
+func init() {
+    RegisterTransform(transformFunc{"trim-trailing", trimTrailingWhitespace})
+    RegisterTransform(transformFunc{"collapse-blank", collapseBlankLines})
+    RegisterTransform(transformFunc{"tabs-to-spaces", tabsToSpaces})
+}
+
+// NewTransformPipeline looks up the named transforms, in order.
+func NewTransformPipeline(names []string) ([]ContentTransform, error) {
+    var pipeline []ContentTransform
+    for _, name := range names {
+        t, ok := transforms[strings.TrimSpace(name)]
+        if !ok {
+            return nil, fmt.Errorf("unknown transform %q (available: %s)", name, strings.Join(transformNames(), ", "))
+        }
+        pipeline = append(pipeline, t)
+    }
+    return pipeline, nil
+}
+
+func transformNames() []string {
+    names := make([]string, 0, len(transforms))
+    for name := range transforms {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func trimTrailingWhitespace(content, _ string) string {
+    lines := strings.Split(content, "\n")
+    for i, line := range lines {
+        lines[i] = strings.TrimRight(line, " \t\r")
+    }
+    return strings.Join(lines, "\n")
+}
+
+// collapseBlankLines squeezes runs of blank lines down to a single one.
+func collapseBlankLines(content, _ string) string {
+    lines := strings.Split(content, "\n")
+    var out []string
+    blank := false
+    for _, line := range lines {
+        if strings.TrimSpace(line) == "" {
+            if blank {
+                continue
+            }
+            blank = true
+            out = append(out, "")
+            continue
+        }
+        blank = false
+        out = append(out, line)
+    }
+    return strings.Join(out, "\n")
+}
+
+// tabsToSpaces expands leading tabs to four spaces. Makefiles are left alone
+// since their recipes must be indented with tabs.
+func tabsToSpaces(content, language string) string {
+    if language == "Makefile" {
+        return content
+    }
+
+    lines := strings.Split(content, "\n")
+    for i, line := range lines {
+        indent := len(line) - len(strings.TrimLeft(line, "\t"))
+        if indent > 0 {
+            lines[i] = strings.Repeat("    ", indent) + line[indent:]
+        }
+    }
+    return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+    tests := []struct {
+        name      string
+        transform string
+        language  string
+        input     string
+        want      string
+    }{
+        {"trailing spaces and tabs", "trim-trailing", "Go", "a  \nb\t\n  c \t\n", "a\nb\n  c\n"},
+        {"carriage returns", "trim-trailing", "Go", "a \r\nb\r\n", "a\nb\n"},
+        {"no final newline", "trim-trailing", "Go", "a  ", "a"},
+        {"runs of blank lines", "collapse-blank", "Go", "a\n\n\n\nb\n \t\n\nc\n", "a\n\nb\n\nc\n"},
+        {"single blank lines", "collapse-blank", "Go", "a\n\nb\n", "a\n\nb\n"},
+        {"leading tabs", "tabs-to-spaces", "Go", "\tx\n\t\ty\tz\n", "    x\n        y\tz\n"},
+        {"makefile recipes", "tabs-to-spaces", "Makefile", "all:\n\tgo build\n", "all:\n\tgo build\n"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := transforms[tt.transform].Apply(tt.input, tt.language); got != tt.want {
+                t.Errorf("%s of %q = %q, want %q", tt.transform, tt.input, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewTransformPipeline(t *testing.T) {
+    pipeline, err := NewTransformPipeline([]string{"collapse-blank", " trim-trailing"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var names []string
+    for _, transform := range pipeline {
+        names = append(names, transform.Name())
+    }
+    if got := strings.Join(names, ","); got != "collapse-blank,trim-trailing" {
+        t.Errorf("pipeline %s, want the order given", got)
+    }
+
+    if _, err := NewTransformPipeline([]string{"trim-trailing", "shrink"}); err == nil || !strings.Contains(err.Error(), `unknown transform "shrink"`) {
+        t.Errorf("unknown transform: got error %v", err)
+    }
+}
+
+func TestContentIsVerbatimByDefault(t *testing.T) {
+    inputs := []string{
+        "package main  \r\n\r\n\r\n\tfunc main() {}\t\n",
+        "no final newline   ",
+        "\n\n\nleading blank lines\n\n\n",
+        "// comment\nimport x from 'y';\n",
+        "café — 日本語\n",
+    }
+
+    cfg := &Config{Path: "/repo"}
+    a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude)}
+    for _, input := range inputs {
+        entry, err := a.createFileEntry("/repo/file.js", []byte(input), int64(len(input)))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if entry.Content != input {
+            t.Errorf("content %q, want %q unchanged", entry.Content, input)
+        }
+
+        var buf bytes.Buffer
+        if err := printFiles([]FileEntry{entry}, false, &buf); err != nil {
+            t.Fatal(err)
+        }
+        if !strings.Contains(buf.String(), input) {
+            t.Errorf("output does not contain %q verbatim:\n%q", input, buf.String())
+        }
+    }
+}
@@ -23,6 +23,41 @@ type Config struct {
     TokenizerType  TokenizerType
     TokenizerModel string
     TokenLimit     int
+    GitTracked     bool
+    GitRef         string
+    ChangedSince   string
+    Staged         bool
+    Unstaged       bool
+    WithDiff       bool
+    DiffOnly       bool
+    DiffContext    int
+    FuncContext    bool
+    Watch          bool
+    Generated      string
+    Verbose        bool
+    Languages      []string
+    TreeTokens     bool
+    TreeDepth      int
+    TreeHighlight  float64
+    Transforms     []string
+    Outline        bool
+    Full           []string
+    LineNumbers    bool
+    LineRanges     []LineRange
+    Secrets        string
+    AllowSensitive bool
+    StrictBudget   bool
+    Selection      string
+    Keymap         *Keymap
+    Theme          Theme
+}
+
+// LineRange restricts files matching Pattern to lines Start through End,
+// as given by an --include entry of the form path:start-end.
+type LineRange struct {
+    Pattern string
+    Start   int
+    End     int
 }
 
 type TokenCount struct {
@@ -37,5 +72,14 @@ type FileEntry struct {
     Path       string
     Content    string
     Size       int64
+    Encoding   string
+    Language   string
+    Generated  string
+    Outlined   bool
+    StartLine  int
+    Diff       string
     TokenCount *TokenCount
+    Savings    map[string]int
+    Secrets    []SecretFinding
+    Warnings   []string
 }
\ No newline at end of file
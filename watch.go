@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const watchDebounce = 300 * time.Millisecond
+
+// Watch keeps re-emitting the output for entries as files under the analyzed
+// path change. Only files touched since the last run are re-read and
+// re-tokenized. It returns only if the watcher fails.
+func (a *Analyzer) Watch(entries []FileEntry) error {
+    watcher, err := newFSWatcher(a.config.Path, a.matcher.IsExcluded)
+    if err != nil {
+        return err
+    }
+    defer watcher.Close()
+
+    current := make(map[string]FileEntry, len(entries))
+    for _, entry := range entries {
+        current[entry.Path] = entry
+    }
+
+    fmt.Fprintf(os.Stderr, "\nWatching %s for changes (Ctrl+C to stop)...\n", a.config.Path)
+
+    for batch := range debounce(watcher.Events(), watchDebounce, time.After) {
+        changed := make(map[string]bool, len(batch))
+        for path := range batch {
+            if relPath, err := filepath.Rel(a.config.Path, path); err == nil {
+                changed[relPath] = true
+            }
+        }
+
+        next, updated, err := a.refresh(current, changed)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+            continue
+        }
+
+        removed := 0
+        for path := range current {
+            if _, ok := next[path]; !ok {
+                removed++
+            }
+        }
+        current = next
+        if updated == 0 && removed == 0 {
+            continue
+        }
+
+        entries = entries[:0]
+        for _, entry := range current {
+            entries = append(entries, entry)
+        }
+        sort.Slice(entries, func(i, j int) bool {
+            return entries[i].Path < entries[j].Path
+        })
+
+        header, err := a.Header()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+        }
+
+        fmt.Printf("\n--- %s: %d updated, %d removed ---\n",
+            time.Now().Format("15:04:05"), updated, removed)
+        if err := generateOutput(entries, header, a.config); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        }
+    }
+
+    return fmt.Errorf("file watcher stopped unexpectedly")
+}
+
+// refresh re-lists the candidate files and re-processes the ones that are new
+// or appear in changed, reusing the existing entries for everything else.
+func (a *Analyzer) refresh(current map[string]FileEntry, changed map[string]bool) (map[string]FileEntry, int, error) {
+    candidates, err := a.ListFiles()
+    if err != nil {
+        return nil, 0, err
+    }
+
+    next := make(map[string]FileEntry, len(candidates))
+    updated := 0
+    for _, candidate := range candidates {
+        entry, ok := current[candidate.Path]
+        if ok && !changed[candidate.Path] {
+            next[candidate.Path] = entry
+            continue
+        }
+
+        entry, err := a.processFile(filepath.Join(a.config.Path, candidate.Path))
+        var skipErr *SkipError
+        if errors.As(err, &skipErr) {
+            continue
+        }
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", candidate.Path, err)
+            continue
+        }
+        printWarnings(entry)
+        next[candidate.Path] = entry
+        updated++
+    }
+
+    return next, updated, nil
+}
+
+// debounce groups paths arriving on in into batches, emitting a batch once no
+// new path has arrived for wait. after starts the wait, as time.After does;
+// tests pass their own to control the clock. A pending batch is flushed when
+// in is closed.
+func debounce(in <-chan string, wait time.Duration, after func(time.Duration) <-chan time.Time) <-chan map[string]bool {
+    out := make(chan map[string]bool)
+
+    go func() {
+        defer close(out)
+
+        pending := make(map[string]bool)
+        var timer <-chan time.Time
+
+        for {
+            select {
+            case path, ok := <-in:
+                if !ok {
+                    if len(pending) > 0 {
+                        out <- pending
+                    }
+                    return
+                }
+                pending[path] = true
+                timer = after(wait)
+            case <-timer:
+                out <- pending
+                pending = make(map[string]bool)
+                timer = nil
+            }
+        }
+    }()
+
+    return out
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE |
+    unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF
+
+// fsWatcher reports paths below a directory tree that were written, created,
+// moved or deleted, using one inotify watch per directory.
+type fsWatcher struct {
+    fd      int
+    file    *os.File
+    mu      sync.Mutex
+    dirs    map[int]string
+    skipDir func(path string) bool
+    events  chan string
+}
+
+func newFSWatcher(root string, skipDir func(path string) bool) (*fsWatcher, error) {
+    fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+    }
+
+    w := &fsWatcher{
+        fd:      fd,
+        file:    os.NewFile(uintptr(fd), "inotify"),
+        dirs:    make(map[int]string),
+        skipDir: skipDir,
+        events:  make(chan string, 256),
+    }
+
+    if err := w.addTree(root, false); err != nil {
+        w.file.Close()
+        return nil, err
+    }
+
+    go w.readEvents()
+    return w, nil
+}
+
+func (w *fsWatcher) Events() <-chan string {
+    return w.events
+}
+
+func (w *fsWatcher) Close() error {
+    return w.file.Close()
+}
+
+// addTree watches root and every directory below it. When notify is set, the
+// files found are reported as events, since they may have appeared before
+// their directory was being watched.
+func (w *fsWatcher) addTree(root string, notify bool) error {
+    return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            // The tree may change underneath us; just watch what is left
+            return nil
+        }
+
+        if !info.IsDir() {
+            if notify {
+                w.events <- path
+            }
+            return nil
+        }
+
+        if path != root && w.skipDir(path) {
+            return filepath.SkipDir
+        }
+
+        wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+        if err != nil {
+            return fmt.Errorf("failed to watch %s: %w", path, err)
+        }
+
+        w.mu.Lock()
+        w.dirs[wd] = path
+        w.mu.Unlock()
+        return nil
+    })
+}
+
+func (w *fsWatcher) readEvents() {
+    defer close(w.events)
+
+    buf := make([]byte, 64*1024)
+    for {
+        n, err := w.file.Read(buf)
+        if err != nil {
+            return
+        }
+
+        for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+            event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+            nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+            offset += unix.SizeofInotifyEvent + int(event.Len)
+
+            w.mu.Lock()
+            dir, ok := w.dirs[int(event.Wd)]
+            if event.Mask&unix.IN_IGNORED != 0 {
+                delete(w.dirs, int(event.Wd))
+            }
+            w.mu.Unlock()
+            if !ok || event.Len == 0 {
+                continue
+            }
+
+            path := filepath.Join(dir, cString(nameBytes))
+            if event.Mask&unix.IN_ISDIR != 0 {
+                if event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+                    if err := w.addTree(path, true); err != nil {
+                        fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+                    }
+                }
+            }
+            w.events <- path
+        }
+    }
+}
+
+func cString(b []byte) string {
+    for i, c := range b {
+        if c == 0 {
+            return string(b[:i])
+        }
+    }
+    return string(b)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+type fsWatcher struct{}
+
+func newFSWatcher(root string, skipDir func(path string) bool) (*fsWatcher, error) {
+    return nil, fmt.Errorf("--watch is only supported on Linux")
+}
+
+func (w *fsWatcher) Events() <-chan string {
+    return nil
+}
+
+func (w *fsWatcher) Close() error {
+    return nil
+}
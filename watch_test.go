@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+    // Each wait started by debounce is handed to the test, which fires it
+    timers := make(chan chan time.Time, 16)
+    after := func(d time.Duration) <-chan time.Time {
+        c := make(chan time.Time, 1)
+        timers <- c
+        return c
+    }
+
+    in := make(chan string)
+    out := debounce(in, time.Second, after)
+
+    expectBatch := func(want map[string]bool) {
+        t.Helper()
+        select {
+        case got := <-out:
+            if !reflect.DeepEqual(got, want) {
+                t.Errorf("batch %v, want %v", got, want)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("no batch, want %v", want)
+        }
+    }
+    expectNone := func() {
+        t.Helper()
+        select {
+        case got := <-out:
+            t.Errorf("unexpected batch %v", got)
+        case <-time.After(50 * time.Millisecond):
+        }
+    }
+
+    // Events close together coalesce, and each restarts the wait
+    in <- "a"
+    in <- "b"
+    in <- "a"
+    first, second, third := <-timers, <-timers, <-timers
+    first <- time.Now()
+    second <- time.Now()
+    expectNone()
+    third <- time.Now()
+    expectBatch(map[string]bool{"a": true, "b": true})
+
+    in <- "c"
+    (<-timers) <- time.Now()
+    expectBatch(map[string]bool{"c": true})
+
+    // Closing the input flushes what is pending
+    in <- "d"
+    <-timers
+    close(in)
+    expectBatch(map[string]bool{"d": true})
+    if _, ok := <-out; ok {
+        t.Error("output not closed after the input")
+    }
+}
+
+func TestRefreshOnlyReprocessesChangedFiles(t *testing.T) {
+    root := t.TempDir()
+    writeFiles(t, root, map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n"})
+
+    cfg := &Config{Path: root, MaxSize: 1 << 20, MaxDepth: 20}
+    a := &Analyzer{config: cfg, matcher: NewPatternMatcher(cfg.Include, cfg.Exclude)}
+
+    // Entries that are not reprocessed keep this content
+    current := map[string]FileEntry{
+        "a.txt": {Path: "a.txt", Content: "as first read\n"},
+        "b.txt": {Path: "b.txt", Content: "as first read\n"},
+        "c.txt": {Path: "c.txt", Content: "as first read\n"},
+    }
+
+    writeFiles(t, root, map[string]string{"a.txt": "a changed\n", "b.txt": "b changed\n", "d.txt": "d\n"})
+    if err := os.Remove(filepath.Join(root, "c.txt")); err != nil {
+        t.Fatal(err)
+    }
+
+    next, updated, err := a.refresh(current, map[string]bool{"b.txt": true, "c.txt": true, "d.txt": true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if updated != 2 {
+        t.Errorf("updated %d entries, want 2", updated)
+    }
+
+    got := make(map[string]string)
+    for path, entry := range next {
+        got[path] = entry.Content
+    }
+    want := map[string]string{"a.txt": "as first read\n", "b.txt": "b changed\n", "d.txt": "d\n"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("refreshed %q, want %q", got, want)
+    }
+}